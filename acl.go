@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/stianba/auth-service/token"
+)
+
+type authKey int
+
+var authenticatedKey authKey
+
+type restrictedField struct {
+	Name  string
+	Level float64
+	Clear func(e *electrician)
+}
+
+// restrictedFields are stripped from read responses, and ignored in request
+// bodies, unless the caller's permission level is at least Level.
+var restrictedFields = []restrictedField{
+	{"createdBy", adminPermissionLevel, func(e *electrician) { e.CreatedBy = "" }},
+	{"updatedBy", adminPermissionLevel, func(e *electrician) { e.UpdatedBy = "" }},
+	{"internalNotes", adminPermissionLevel, func(e *electrician) { e.InternalNotes = "" }},
+}
+
+func withUser(r *http.Request, u token.UserPersistentData) *http.Request {
+	r = r.WithContext(token.ToContext(u, r))
+	return r.WithContext(context.WithValue(r.Context(), authenticatedKey, true))
+}
+
+// permissionLevel returns the caller's permission level, or 0 for anonymous callers.
+func permissionLevel(r *http.Request) float64 {
+	if r.Context().Value(authenticatedKey) == nil {
+		return 0
+	}
+
+	return token.GetContext(r).PermissionLevel
+}
+
+// optionalAuth attaches the user to the request when a valid token is sent,
+// and otherwise serves the request anonymously.
+func optionalAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authHeader, ok := r.Header["Authorization"]
+
+		if ok {
+			persistentData, err := userFromHeader(authHeader)
+
+			if err == nil {
+				r = withUser(r, persistentData)
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func stripRestrictedOne(r *http.Request, e *electrician) {
+	level := permissionLevel(r)
+
+	for _, field := range restrictedFields {
+		if level < field.Level {
+			field.Clear(e)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+
+	"gopkg.in/mgo.v2"
+)
+
+type reindexResult struct {
+	Dropped []string `json:"dropped"`
+	Indexes []string `json:"indexes"`
+}
+
+func indexNames(c *mgo.Collection) ([]string, error) {
+	indexes, err := c.Indexes()
+
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(indexes))
+
+	for _, index := range indexes {
+		names = append(names, index.Name)
+	}
+
+	return names, nil
+}
+
+func reindex(s *mgo.Session) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session := s.Copy()
+		defer session.Close()
+
+		c := session.DB(os.Getenv("DB_NAME")).C(collection)
+		result := reindexResult{Dropped: make([]string, 0)}
+
+		existing, err := indexNames(c)
+
+		if err != nil {
+			errorWithJSON(w, "Database error", http.StatusInternalServerError)
+			log.Println("Failed list indexes: ", err)
+			return
+		}
+
+		for _, name := range existing {
+			if name == "_id_" {
+				continue
+			}
+
+			err = c.DropIndexName(name)
+
+			if err != nil {
+				errorWithJSON(w, "Database error", http.StatusInternalServerError)
+				log.Println("Failed drop index: ", err)
+				return
+			}
+
+			result.Dropped = append(result.Dropped, name)
+		}
+
+		session.ResetIndexCache()
+		err = createIndexes(c)
+
+		if err != nil {
+			errorWithJSON(w, "Database error", http.StatusInternalServerError)
+			log.Println("Failed create indexes: ", err)
+			return
+		}
+
+		result.Indexes, err = indexNames(c)
+
+		if err != nil {
+			errorWithJSON(w, "Database error", http.StatusInternalServerError)
+			log.Println("Failed list indexes: ", err)
+			return
+		}
+
+		jsonData, err := json.Marshal(result)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		responseWithJSON(w, jsonData, http.StatusOK)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	defaultAuditLimit int = 1000
+	maxAuditLimit     int = 10000
+)
+
+type auditFailure struct {
+	ID     string            `json:"id"`
+	Fields map[string]string `json:"fields"`
+}
+
+type auditReport struct {
+	Checked  int            `json:"checked"`
+	Failures []auditFailure `json:"failures"`
+	Next     string         `json:"next,omitempty"`
+}
+
+// auditRecords runs up to limit stored records, in id order after the after
+// id, through the write-time validators and reports the ones that fail.
+// Feeding next back as after continues the scan. Records that cannot be
+// decoded at all are reported with a document field.
+func auditRecords(s *mgo.Session) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session := readSession(s)
+		defer session.Close()
+
+		queries := r.URL.Query()
+		query := notDeleted()
+
+		if after := queries.Get("after"); after != "" {
+			if !bson.IsObjectIdHex(after) {
+				errorWithJSON(w, "after must be an id", http.StatusBadRequest)
+				return
+			}
+
+			query["_id"] = bson.M{"$gt": bson.ObjectIdHex(after)}
+		}
+
+		limit := defaultAuditLimit
+
+		if value := queries.Get("limit"); value != "" {
+			var err error
+			limit, err = strconv.Atoi(value)
+
+			if err != nil || limit < 1 || limit > maxAuditLimit {
+				errorWithJSON(w, "limit must be between 1 and 10000", http.StatusBadRequest)
+				return
+			}
+		}
+
+		c := session.DB(os.Getenv("DB_NAME")).C(collection)
+		iter := c.Find(query).Sort("_id").Limit(limit).Iter()
+		started := time.Now()
+
+		report := auditReport{Failures: make([]auditFailure, 0)}
+		var raw bson.Raw
+		var last bson.ObjectId
+
+		for iter.Next(&raw) {
+			var stored struct {
+				ID bson.ObjectId `bson:"_id"`
+			}
+
+			raw.Unmarshal(&stored)
+			last = stored.ID
+			report.Checked++
+
+			var e electrician
+			fields := map[string]string{"document": "undecodable"}
+
+			if raw.Unmarshal(&e) == nil {
+				fields = validateElectrician(e)
+			}
+
+			if len(fields) > 0 {
+				report.Failures = append(report.Failures, auditFailure{ID: stored.ID.Hex(), Fields: fields})
+			}
+
+			raw = bson.Raw{}
+
+			if report.Checked%dumpFlushEvery == 0 && clientGone(r) {
+				iter.Close()
+				return
+			}
+		}
+
+		err := iter.Close()
+		logSlowQuery("audit", query, started)
+
+		if err != nil {
+			errorWithJSON(w, "Database error", http.StatusInternalServerError)
+			log.Println("Failed audit electricians: ", err)
+			return
+		}
+
+		if report.Checked == limit {
+			report.Next = last.Hex()
+		}
+
+		jsonData, err := json.Marshal(report)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		responseWithJSON(w, jsonData, http.StatusOK)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+type verifiedToken struct {
+	ID              string  `json:"id"`
+	PermissionLevel float64 `json:"permissionLevel"`
+	Expires         int64   `json:"expires,omitempty"`
+}
+
+// tokenExpiry reads the exp claim of an already verified bearer token.
+func tokenExpiry(header string) int64 {
+	parts := strings.Split(strings.TrimPrefix(header, "Bearer "), ".")
+
+	if len(parts) != 3 {
+		return 0
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+
+	if err != nil {
+		return 0
+	}
+
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+
+	json.Unmarshal(payload, &claims)
+	return claims.Exp
+}
+
+func verifyToken(w http.ResponseWriter, r *http.Request) {
+	authHeader, ok := r.Header["Authorization"]
+
+	if !ok {
+		errorWithJSON(w, "No auth header found", http.StatusUnauthorized)
+		return
+	}
+
+	persistentData, err := userFromHeader(authHeader)
+
+	if err != nil {
+		errorWithJSON(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	jsonData, _ := json.Marshal(verifiedToken{
+		ID:              persistentData.ID,
+		PermissionLevel: persistentData.PermissionLevel,
+		Expires:         tokenExpiry(authHeader[0]),
+	})
+
+	responseWithJSON(w, jsonData, http.StatusOK)
+}
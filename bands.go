@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var defaultDistanceBands = []float64{5000, 10000, 25000}
+
+type distanceBand struct {
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Count int     `json:"count"`
+}
+
+// countDistanceBands counts the records within each distance band around
+// near, where bands are ascending upper bounds in meters.
+func countDistanceBands(c *mgo.Collection, near []float64, bands []float64) ([]distanceBand, error) {
+	boundaries := append([]float64{0}, bands...)
+	last := bands[len(bands)-1]
+
+	pipes := []bson.M{
+		{"$geoNear": bson.M{
+			"near":          bson.M{"type": "Point", "coordinates": near},
+			"distanceField": "distance",
+			"spherical":     true,
+			"maxDistance":   last,
+			"query":         notDeleted(),
+		}},
+		{"$bucket": bson.M{
+			"groupBy":    "$distance",
+			"boundaries": boundaries,
+			"default":    last,
+			"output":     bson.M{"count": bson.M{"$sum": 1}},
+		}},
+	}
+
+	var found []struct {
+		Min   float64 `bson:"_id"`
+		Count int     `bson:"count"`
+	}
+
+	started := time.Now()
+	err := c.Pipe(pipes).All(&found)
+	logSlowQuery("distance bands", pipes, started)
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]distanceBand, len(bands))
+
+	for i := range bands {
+		result[i] = distanceBand{Min: boundaries[i], Max: boundaries[i+1]}
+	}
+
+	for _, f := range found {
+		for i := range result {
+			// Records exactly at the last bound fall in the $bucket default.
+			if f.Min == result[i].Min || f.Min == last && i == len(result)-1 {
+				result[i].Count += f.Count
+			}
+		}
+	}
+
+	return result, nil
+}
+
+func distanceBands(s *mgo.Session) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session := readSession(s)
+		defer session.Close()
+
+		queries := r.URL.Query()
+
+		lon, lonErr := strconv.ParseFloat(queries.Get("lon"), 64)
+		lat, latErr := strconv.ParseFloat(queries.Get("lat"), 64)
+
+		if lonErr != nil || latErr != nil || lon < -180 || lon > 180 || lat < -90 || lat > 90 {
+			errorWithJSON(w, "lon and lat must be valid coordinates", http.StatusBadRequest)
+			return
+		}
+
+		bands := defaultDistanceBands
+
+		if value := queries.Get("bands"); value != "" {
+			var err error
+			bands, err = parseBuckets(value)
+
+			if err != nil {
+				errorWithJSON(w, "bands must be distances in meters", http.StatusBadRequest)
+				return
+			}
+		}
+
+		for i, distance := range bands {
+			if distance <= 0 || i > 0 && distance <= bands[i-1] {
+				errorWithJSON(w, "bands must be positive distances in meters in ascending order", http.StatusBadRequest)
+				return
+			}
+		}
+
+		c := session.DB(os.Getenv("DB_NAME")).C(collection)
+		result, err := countDistanceBands(c, []float64{lon, lat}, bands)
+
+		if err != nil {
+			errorWithJSON(w, "Database error", http.StatusInternalServerError)
+			log.Println("Failed count distance bands: ", err)
+			return
+		}
+
+		jsonData, err := json.Marshal(result)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		responseWithJSON(w, jsonData, http.StatusOK)
+	}
+}
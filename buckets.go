@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type distanceBucket struct {
+	Min          float64       `json:"min" bson:"_id"`
+	Max          float64       `json:"max" bson:"-"`
+	Count        int           `json:"count" bson:"count"`
+	Electricians []electrician `json:"electricians" bson:"electricians"`
+}
+
+// projectedBucket is a distanceBucket with its electricians reduced to the
+// response fields.
+type projectedBucket struct {
+	Min          float64         `json:"min"`
+	Max          float64         `json:"max"`
+	Count        int             `json:"count"`
+	Electricians json.RawMessage `json:"electricians"`
+}
+
+func projectBuckets(buckets []distanceBucket, fields []string) ([]projectedBucket, error) {
+	projected := make([]projectedBucket, len(buckets))
+
+	for i, bucket := range buckets {
+		electricians, err := marshalFields(bucket.Electricians, fields)
+
+		if err != nil {
+			return nil, err
+		}
+
+		projected[i] = projectedBucket{Min: bucket.Min, Max: bucket.Max, Count: bucket.Count, Electricians: electricians}
+	}
+
+	return projected, nil
+}
+
+// parseBuckets reads distance boundaries in meters, e.g. "5000,10000,25000".
+func parseBuckets(value string) ([]float64, error) {
+	var buckets []float64
+
+	for _, part := range strings.Split(value, ",") {
+		distance, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+
+		if err != nil {
+			return nil, fmt.Errorf("buckets must be distances in meters")
+		}
+
+		buckets = append(buckets, distance)
+	}
+
+	return buckets, nil
+}
+
+// bucketByDistance groups the records matched by pipes by distance. Counts
+// cover every match, while the electricians in each bucket are those on the
+// page given by skip and limit.
+func bucketByDistance(c *mgo.Collection, pipes []bson.M, skip int, limit int, buckets []float64) ([]distanceBucket, error) {
+	boundaries := append([]float64{0}, buckets...)
+
+	bucket := func(output bson.M) bson.M {
+		return bson.M{"$bucket": bson.M{
+			"groupBy":    "$distance",
+			"boundaries": boundaries,
+			"default":    buckets[len(buckets)-1],
+			"output":     output,
+		}}
+	}
+
+	stages := bson.M{
+		"counts": []bson.M{bucket(bson.M{"count": bson.M{"$sum": 1}})},
+		"page": []bson.M{
+			{"$skip": skip},
+			{"$limit": limit},
+			bucket(bson.M{"electricians": bson.M{"$push": "$$ROOT"}}),
+		},
+	}
+
+	var found struct {
+		Counts []distanceBucket `bson:"counts"`
+		Page   []distanceBucket `bson:"page"`
+	}
+
+	err := c.Pipe(append(pipes[:len(pipes):len(pipes)], bson.M{"$facet": stages})).One(&found)
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]distanceBucket, len(buckets))
+
+	for i := range buckets {
+		result[i] = distanceBucket{Min: boundaries[i], Max: boundaries[i+1], Electricians: make([]electrician, 0)}
+
+		for _, f := range found.Counts {
+			if f.Min == boundaries[i] {
+				result[i].Count = f.Count
+			}
+		}
+
+		for _, f := range found.Page {
+			if f.Min == boundaries[i] {
+				result[i].Electricians = f.Electricians
+			}
+		}
+	}
+
+	return result, nil
+}
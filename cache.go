@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const defaultCacheSize int = 1000
+
+// cachedRoutes are the read routes whose responses are cached. Any other
+// non-GET request is treated as a write and empties the cache.
+var cachedRoutes = map[string]bool{
+	"list":          true,
+	"search":        true,
+	"get":           true,
+	"clusters":      true,
+	"cities":        true,
+	"counties":      true,
+	"distanceBands": true,
+}
+
+// cachedHeaders are the response headers set by cached handlers. Headers set
+// by other middleware, such as X-Request-Id, rate limits and CORS, belong to
+// each request and are never replayed.
+var cachedHeaders = []string{
+	"Content-Type",
+	"Last-Modified",
+	"X-Total-Count",
+	"X-Total-Count-Estimated",
+	"X-Total-Pages",
+	"X-Page",
+	"X-Page-Size",
+	"Deprecation",
+	"Warning",
+}
+
+type cacheEntry struct {
+	key     string
+	status  int
+	header  http.Header
+	vary    []string
+	body    []byte
+	expires time.Time
+}
+
+type responseCache struct {
+	mu       sync.Mutex
+	size     int
+	ttl      time.Duration
+	order    *list.List
+	entries  map[string]*list.Element
+	hits     uint64
+	misses   uint64
+	purges   uint64
+	disabled bool
+}
+
+type cacheStats struct {
+	Enabled bool   `json:"enabled"`
+	Entries int    `json:"entries"`
+	Hits    uint64 `json:"hits"`
+	Misses  uint64 `json:"misses"`
+	Purges  uint64 `json:"purges"`
+}
+
+// cache is disabled when CACHE_TTL is unset.
+var cache = &responseCache{disabled: true}
+
+func initCache() {
+	value := os.Getenv("CACHE_TTL")
+
+	if value == "" {
+		return
+	}
+
+	ttl, err := time.ParseDuration(value)
+
+	if err != nil {
+		panic(err)
+	}
+
+	size := defaultCacheSize
+
+	if value := os.Getenv("CACHE_SIZE"); value != "" {
+		size, err = strconv.Atoi(value)
+
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	cache = &responseCache{size: size, ttl: ttl, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+func (rc *responseCache) get(key string) (*cacheEntry, bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	element, ok := rc.entries[key]
+
+	if !ok || time.Now().After(element.Value.(*cacheEntry).expires) {
+		if ok {
+			rc.order.Remove(element)
+			delete(rc.entries, key)
+		}
+
+		rc.misses++
+		return nil, false
+	}
+
+	rc.hits++
+	rc.order.MoveToFront(element)
+	return element.Value.(*cacheEntry), true
+}
+
+func (rc *responseCache) add(entry *cacheEntry) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if element, ok := rc.entries[entry.key]; ok {
+		rc.order.Remove(element)
+	}
+
+	rc.entries[entry.key] = rc.order.PushFront(entry)
+
+	for rc.order.Len() > rc.size {
+		oldest := rc.order.Back()
+		rc.order.Remove(oldest)
+		delete(rc.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+func (rc *responseCache) purge() {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	rc.order.Init()
+	rc.entries = make(map[string]*list.Element)
+	rc.purges++
+}
+
+func (rc *responseCache) stats() cacheStats {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	stats := cacheStats{Enabled: !rc.disabled, Hits: rc.hits, Misses: rc.misses, Purges: rc.purges}
+
+	if !rc.disabled {
+		stats.Entries = rc.order.Len()
+	}
+
+	return stats
+}
+
+type cacheRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (cr *cacheRecorder) WriteHeader(status int) {
+	cr.status = status
+	cr.ResponseWriter.WriteHeader(status)
+}
+
+func (cr *cacheRecorder) Write(b []byte) (int, error) {
+	cr.body.Write(b)
+	return cr.ResponseWriter.Write(b)
+}
+
+// writeRecorder records the status of a write so the cache is only emptied
+// when the write succeeded.
+type writeRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (wr *writeRecorder) WriteHeader(status int) {
+	wr.status = status
+	wr.ResponseWriter.WriteHeader(status)
+}
+
+func (wr *writeRecorder) Flush() {
+	if flusher, ok := wr.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// cacheKey includes the headers that change the response: the token decides
+// which fields are visible, Accept-Language the text search language and
+// Accept whether search results are enveloped.
+func cacheKey(r *http.Request) string {
+	return r.URL.Path + "?" + r.URL.Query().Encode() + "|" + r.Header.Get("Authorization") + "|" + r.Header.Get("Accept-Language") + "|" + r.Header.Get("Accept")
+}
+
+// withCache serves cached GET responses for cachedRoutes and empties the
+// cache after every successful write, since any write can change any cached
+// result.
+func withCache(router *mux.Router, next http.Handler) http.Handler {
+	if cache.disabled {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var match mux.RouteMatch
+
+		if !router.Match(r, &match) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		readRoute := cachedRoutes[match.Route.GetName()]
+
+		if r.Method != "GET" && r.Method != "HEAD" && r.Method != "OPTIONS" && !readRoute {
+			recorder := &writeRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(recorder, r)
+
+			if recorder.status >= 200 && recorder.status < 300 {
+				cache.purge()
+			}
+
+			return
+		}
+
+		if r.Method != "GET" || !readRoute || r.Header.Get("If-Modified-Since") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := cacheKey(r)
+
+		if entry, ok := cache.get(key); ok {
+			for name, values := range entry.header {
+				w.Header()[name] = values
+			}
+
+			for _, value := range entry.vary {
+				w.Header().Add("Vary", value)
+			}
+
+			w.Header().Set("X-Cache", "HIT")
+			w.WriteHeader(entry.status)
+			w.Write(entry.body)
+			return
+		}
+
+		w.Header().Set("X-Cache", "MISS")
+		recorder := &cacheRecorder{ResponseWriter: w, status: http.StatusOK}
+		// Vary is shared with CORS, so only the values the handler adds are kept.
+		varyBefore := len(w.Header()["Vary"])
+		next.ServeHTTP(recorder, r)
+
+		if recorder.status != http.StatusOK {
+			return
+		}
+
+		header := make(http.Header)
+
+		for _, name := range cachedHeaders {
+			if values, ok := w.Header()[name]; ok {
+				header[name] = values
+			}
+		}
+
+		vary := append([]string(nil), w.Header()["Vary"][varyBefore:]...)
+		cache.add(&cacheEntry{key: key, status: recorder.status, header: header, vary: vary, body: recorder.body.Bytes(), expires: time.Now().Add(cache.ttl)})
+	})
+}
+
+func showCacheStats(w http.ResponseWriter, r *http.Request) {
+	jsonData, err := json.Marshal(cache.stats())
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	responseWithJSON(w, jsonData, http.StatusOK)
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	defaultChangesLimit int = 100
+	maxChangesLimit     int = 1000
+)
+
+type tombstone struct {
+	ID        string    `json:"id"`
+	DeletedAt time.Time `json:"deletedAt"`
+}
+
+type changeFeed struct {
+	Changed json.RawMessage `json:"changed"`
+	Deleted []tombstone     `json:"deleted"`
+	Next    string          `json:"next"`
+	HasMore bool            `json:"hasMore"`
+}
+
+// changeCursor is a position in the (updatedAt, _id) order of the change
+// feed. Without an id it is the start of updatedAt.
+type changeCursor struct {
+	UpdatedAt time.Time
+	ID        bson.ObjectId
+}
+
+func (cursor changeCursor) String() string {
+	value := cursor.UpdatedAt.UTC().Format(time.RFC3339Nano) + "|" + cursor.ID.Hex()
+	return base64.RawURLEncoding.EncodeToString([]byte(value))
+}
+
+func parseChangeCursor(value string) (cursor changeCursor, err error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(value)
+	parts := strings.SplitN(string(decoded), "|", 2)
+
+	if err != nil || len(parts) != 2 || parts[1] != "" && !bson.IsObjectIdHex(parts[1]) {
+		return cursor, fmt.Errorf("cursor must be next from a previous response")
+	}
+
+	cursor.UpdatedAt, err = time.Parse(time.RFC3339Nano, parts[0])
+
+	if err != nil {
+		return cursor, fmt.Errorf("cursor must be next from a previous response")
+	}
+
+	if parts[1] != "" {
+		cursor.ID = bson.ObjectIdHex(parts[1])
+	}
+
+	return cursor, nil
+}
+
+// after matches the records following the cursor when sorted by updatedAt
+// and _id, so records sharing a timestamp are paged through by id.
+func (cursor changeCursor) after() bson.M {
+	if cursor.ID == "" {
+		return bson.M{"updatedAt": bson.M{"$gte": cursor.UpdatedAt}}
+	}
+
+	return bson.M{"$or": []bson.M{
+		{"updatedAt": bson.M{"$gt": cursor.UpdatedAt}},
+		{"updatedAt": cursor.UpdatedAt, "_id": bson.M{"$gt": cursor.ID}},
+	}}
+}
+
+// changes returns records created, updated or deleted at or after since,
+// oldest first. Feeding next back as cursor continues the feed.
+func changes(s *mgo.Session) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session := readSession(s)
+		defer session.Close()
+
+		queries := r.URL.Query()
+
+		var cursor changeCursor
+		var err error
+
+		if value := queries.Get("cursor"); value != "" {
+			cursor, err = parseChangeCursor(value)
+
+			if err != nil {
+				errorWithJSON(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		} else {
+			cursor.UpdatedAt, err = time.Parse(time.RFC3339Nano, queries.Get("since"))
+
+			if err != nil {
+				errorWithJSON(w, "since must be an RFC 3339 timestamp, or cursor next from a previous response", http.StatusBadRequest)
+				return
+			}
+		}
+
+		limit := defaultChangesLimit
+
+		if value := queries.Get("limit"); value != "" {
+			limit, err = strconv.Atoi(value)
+
+			if err != nil || limit < 1 || limit > maxChangesLimit {
+				errorWithJSON(w, "limit must be between 1 and 1000", http.StatusBadRequest)
+				return
+			}
+		}
+
+		var electricians []electrician
+
+		c := session.DB(os.Getenv("DB_NAME")).C(collection)
+		query := cursor.after()
+		started := time.Now()
+		err = c.Find(query).Sort("updatedAt", "_id").Limit(limit + 1).All(&electricians)
+		logSlowQuery("changes", query, started)
+
+		if err != nil {
+			errorWithJSON(w, "Database error", http.StatusInternalServerError)
+			log.Println("Failed get changes: ", err)
+			return
+		}
+
+		if clientGone(r) {
+			return
+		}
+
+		changed := make([]electrician, 0)
+		feed := changeFeed{
+			Deleted: make([]tombstone, 0),
+			Next:    cursor.String(),
+			HasMore: len(electricians) > limit,
+		}
+
+		if feed.HasMore {
+			electricians = electricians[:limit]
+		}
+
+		prepareElectricians(r, electricians)
+
+		for _, e := range electricians {
+			if e.DeletedAt != nil {
+				feed.Deleted = append(feed.Deleted, tombstone{ID: e.ID.Hex(), DeletedAt: *e.DeletedAt})
+			} else {
+				changed = append(changed, e)
+			}
+
+			feed.Next = changeCursor{UpdatedAt: e.UpdatedAt, ID: e.ID}.String()
+		}
+
+		feed.Changed, err = marshalFields(changed, responseFields(r))
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		jsonData, err := json.Marshal(feed)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		responseWithJSON(w, jsonData, http.StatusOK)
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	clusterMaxZoom  int = 14
+	clusterMaxPoint int = 500
+)
+
+type cluster struct {
+	Coordinates []float64       `json:"coordinates"`
+	Count       int             `json:"count"`
+	Electrician json.RawMessage `json:"electrician,omitempty"`
+}
+
+// parseBBox reads a "minLon,minLat,maxLon,maxLat" bounding box.
+func parseBBox(value string) (bbox [4]float64, err error) {
+	parts := strings.Split(value, ",")
+
+	if len(parts) != 4 {
+		err = fmt.Errorf("bbox must be minLon,minLat,maxLon,maxLat")
+		return
+	}
+
+	for i, part := range parts {
+		bbox[i], err = strconv.ParseFloat(strings.TrimSpace(part), 64)
+
+		if err != nil {
+			err = fmt.Errorf("bbox must only contain numbers")
+			return
+		}
+	}
+
+	if bbox[0] > bbox[2] || bbox[1] > bbox[3] {
+		err = fmt.Errorf("bbox min values must not exceed max values")
+	}
+
+	return
+}
+
+func clusters(s *mgo.Session) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session := readSession(s)
+		defer session.Close()
+
+		queries := r.URL.Query()
+
+		bbox, err := parseBBox(queries.Get("bbox"))
+
+		if err != nil {
+			errorWithJSON(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		zoom, err := strconv.Atoi(queries.Get("zoom"))
+
+		if err != nil || zoom < 0 || zoom > 22 {
+			errorWithJSON(w, "zoom must be a number between 0 and 22", http.StatusBadRequest)
+			return
+		}
+
+		query := notDeleted()
+		query["location"] = bson.M{"$geoWithin": bson.M{
+			"$box": [][]float64{{bbox[0], bbox[1]}, {bbox[2], bbox[3]}},
+		}}
+		match := bson.M{"$match": query}
+
+		c := session.DB(os.Getenv("DB_NAME")).C(collection)
+		result := make([]cluster, 0)
+
+		if zoom >= clusterMaxZoom {
+			var electricians []electrician
+			started := time.Now()
+			err = c.Pipe([]bson.M{match, {"$limit": clusterMaxPoint}}).All(&electricians)
+			logSlowQuery("cluster points", match, started)
+
+			if err != nil {
+				errorWithJSON(w, "Database error", http.StatusInternalServerError)
+				log.Println("Failed get cluster points: ", err)
+				return
+			}
+
+			prepareElectricians(r, electricians)
+			fields := responseFields(r)
+
+			for i := range electricians {
+				// Points are projected like search results, so PUBLIC_FIELDS applies.
+				electricianJSON, err := marshalFields(electricians[i], fields)
+
+				if err != nil {
+					log.Fatal(err)
+				}
+
+				result = append(result, cluster{
+					Coordinates: electricians[i].Location.Coordinates,
+					Count:       1,
+					Electrician: electricianJSON,
+				})
+			}
+		} else {
+			cellSize := 360 / math.Pow(2, float64(zoom))
+			lon := bson.M{"$arrayElemAt": []interface{}{"$location.coordinates", 0}}
+			lat := bson.M{"$arrayElemAt": []interface{}{"$location.coordinates", 1}}
+
+			group := bson.M{"$group": bson.M{
+				"_id": bson.M{
+					"x": bson.M{"$floor": bson.M{"$divide": []interface{}{lon, cellSize}}},
+					"y": bson.M{"$floor": bson.M{"$divide": []interface{}{lat, cellSize}}},
+				},
+				"count": bson.M{"$sum": 1},
+				"lon":   bson.M{"$avg": lon},
+				"lat":   bson.M{"$avg": lat},
+			}}
+
+			var buckets []struct {
+				Count int     `bson:"count"`
+				Lon   float64 `bson:"lon"`
+				Lat   float64 `bson:"lat"`
+			}
+
+			started := time.Now()
+			err = c.Pipe([]bson.M{match, group}).All(&buckets)
+			logSlowQuery("clusters", []bson.M{match, group}, started)
+
+			if err != nil {
+				errorWithJSON(w, "Database error", http.StatusInternalServerError)
+				log.Println("Failed get clusters: ", err)
+				return
+			}
+
+			for _, b := range buckets {
+				result = append(result, cluster{Coordinates: projectCoordinates(r, []float64{b.Lon, b.Lat}), Count: b.Count})
+			}
+		}
+
+		if clientGone(r) {
+			return
+		}
+
+		jsonData, err := json.Marshal(result)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		responseWithJSON(w, jsonData, http.StatusOK)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import "gopkg.in/mgo.v2/bson"
+
+// completenessFields are the fields a complete record is expected to have,
+// in addition to coordinates.
+var completenessFields = []string{"name", "addressLine1", "city", "county", "zip", "phone"}
+
+func completenessStage() bson.M {
+	present := make([]interface{}, 0, len(completenessFields)+1)
+
+	for _, field := range completenessFields {
+		present = append(present, bson.M{"$cond": []interface{}{
+			bson.M{"$gt": []interface{}{bson.M{"$strLenCP": bson.M{"$ifNull": []interface{}{"$" + field, ""}}}, 0}}, 1, 0,
+		}})
+	}
+
+	present = append(present, bson.M{"$cond": []interface{}{
+		bson.M{"$gt": []interface{}{bson.M{"$size": bson.M{"$ifNull": []interface{}{"$location.coordinates", []interface{}{}}}}, 0}}, 1, 0,
+	}})
+
+	return bson.M{"$addFields": bson.M{"completeness": bson.M{
+		"$divide": []interface{}{bson.M{"$add": present}, len(present)},
+	}}}
+}
+
+func computeCompleteness(e *electrician) {
+	values := []string{e.Name, e.AddressLine1, e.City, e.County, e.Zip, e.Phone}
+	present := 0
+
+	for _, value := range values {
+		if value != "" {
+			present++
+		}
+	}
+
+	if len(e.Location.Coordinates) > 0 {
+		present++
+	}
+
+	completeness := float64(present) / float64(len(values)+1)
+	e.Completeness = &completeness
+}
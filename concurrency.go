@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+)
+
+// requestSlots is a semaphore of MAX_CONCURRENT_REQUESTS slots, or nil when
+// the number of in-flight requests is unlimited.
+var requestSlots chan struct{}
+
+func initConcurrencyLimit() {
+	value := os.Getenv("MAX_CONCURRENT_REQUESTS")
+
+	if value == "" {
+		return
+	}
+
+	limit, err := strconv.Atoi(value)
+
+	if err != nil {
+		panic(err)
+	}
+
+	requestSlots = make(chan struct{}, limit)
+}
+
+// limitConcurrency refuses requests with a 503 while every slot is taken.
+// Streaming routes stay open for as long as clients listen, so they don't
+// take a slot. It goes inside withTimeout, so a timed out request keeps its
+// slot until the handler behind it has actually returned.
+func limitConcurrency(next http.Handler) http.Handler {
+	if requestSlots == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if streamingPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		select {
+		case requestSlots <- struct{}{}:
+			defer func() { <-requestSlots }()
+			next.ServeHTTP(w, r)
+		default:
+			w.Header().Set("Retry-After", "1")
+			errorWithJSON(w, "server_busy", http.StatusServiceUnavailable)
+		}
+	})
+}
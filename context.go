@@ -0,0 +1,20 @@
+package main
+
+import (
+	"log"
+	"net/http"
+)
+
+// clientGone reports whether the request was cancelled, usually because the
+// client disconnected. mgo queries can't be interrupted, so handlers check
+// this between expensive steps and stop early instead of working for nobody.
+func clientGone(r *http.Request) bool {
+	err := r.Context().Err()
+
+	if err != nil {
+		log.Printf("Abandoning %v %v for %v: %v", r.Method, r.URL.Path, clientIP(r), err)
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stianba/auth-service/token"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func inBBox(bbox [4]float64, lon, lat float64) bool {
+	return lon >= bbox[0] && lon <= bbox[2] && lat >= bbox[1] && lat <= bbox[3]
+}
+
+// defaultBBox is the expected area of coordinates, from DEFAULT_BBOX.
+var defaultBBox *[4]float64
+
+func initDefaultBBox() {
+	value := os.Getenv("DEFAULT_BBOX")
+
+	if value == "" {
+		return
+	}
+
+	bbox, err := parseBBox(value)
+
+	if err != nil {
+		panic(fmt.Errorf("DEFAULT_BBOX: %v", err))
+	}
+
+	defaultBBox = &bbox
+}
+
+// validateCoordinates checks a GeoJSON [lon, lat] pair, and when DEFAULT_BBOX
+// is set, that it falls inside the expected area.
+func validateCoordinates(coordinates []float64) error {
+	if len(coordinates) != 2 {
+		return fmt.Errorf("coordinates must be [lon, lat]")
+	}
+
+	lon, lat := coordinates[0], coordinates[1]
+
+	if lon < -180 || lon > 180 || lat < -90 || lat > 90 {
+		return fmt.Errorf("coordinates out of range, expected [lon, lat]")
+	}
+
+	if defaultBBox == nil || inBBox(*defaultBBox, lon, lat) {
+		return nil
+	}
+
+	if inBBox(*defaultBBox, lat, lon) {
+		return fmt.Errorf("coordinates are outside the expected area, but [%v, %v] is inside: they may be [lat, lon] instead of [lon, lat]", lat, lon)
+	}
+
+	return fmt.Errorf("coordinates are outside the expected area")
+}
+
+// coordinateError is returned when decoding coordinates that are neither
+// numbers nor numeric strings.
+type coordinateError struct {
+	value string
+}
+
+func (err *coordinateError) Error() string {
+	return fmt.Sprintf("coordinates must be numbers, got %v", err.value)
+}
+
+// UnmarshalJSON accepts coordinates as numbers or numeric strings, since some
+// clients send ["10.5", "59.2"].
+func (g *geo) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Coordinates []json.RawMessage `json:"coordinates"`
+	}
+
+	err := json.Unmarshal(data, &raw)
+
+	if err != nil {
+		return err
+	}
+
+	g.Coordinates = nil
+
+	for _, value := range raw.Coordinates {
+		var number string
+
+		if json.Unmarshal(value, &number) != nil {
+			number = string(value)
+		}
+
+		coordinate, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+
+		if err != nil || math.IsNaN(coordinate) || math.IsInf(coordinate, 0) {
+			return &coordinateError{string(value)}
+		}
+
+		g.Coordinates = append(g.Coordinates, coordinate)
+	}
+
+	return nil
+}
+
+type coordinateUpdate struct {
+	ID          string    `json:"id"`
+	Coordinates []float64 `json:"coordinates"`
+}
+
+// updateCoordinates applies externally geocoded coordinates in one bulk write
+// and reports a result per record.
+func updateCoordinates(s *mgo.Session) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session := requestSession(s)
+		defer session.Close()
+
+		var updates []coordinateUpdate
+
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&updates)
+
+		if err != nil {
+			errorWithJSON(w, "Incorrect body", http.StatusBadRequest)
+			return
+		}
+
+		if len(updates) > maxImportSize {
+			errorWithJSON(w, fmt.Sprintf("At most %v records can be updated at once", maxImportSize), http.StatusBadRequest)
+			return
+		}
+
+		results := make([]importResult, len(updates))
+		ids := make([]bson.ObjectId, 0, len(updates))
+
+		for i, update := range updates {
+			results[i] = importResult{Index: i}
+
+			if !bson.IsObjectIdHex(update.ID) {
+				results[i].Status = "error"
+				results[i].Message = "Invalid id"
+				continue
+			}
+
+			if err := validateCoordinates(update.Coordinates); err != nil {
+				results[i].Status = "error"
+				results[i].Message = err.Error()
+				continue
+			}
+
+			ids = append(ids, bson.ObjectIdHex(update.ID))
+		}
+
+		c := session.DB(os.Getenv("DB_NAME")).C(collection)
+
+		var existing []electrician
+
+		query := notDeleted()
+		query["_id"] = bson.M{"$in": ids}
+		err = c.Find(query).Select(bson.M{"_id": 1}).All(&existing)
+
+		if err != nil {
+			errorWithJSON(w, "Database error", http.StatusInternalServerError)
+			log.Println("Failed find existing electricians: ", err)
+			return
+		}
+
+		exists := make(map[bson.ObjectId]bool)
+
+		for _, e := range existing {
+			exists[e.ID] = true
+		}
+
+		bulk := c.Bulk()
+		bulk.Unordered()
+
+		var operations []int
+		userID := token.GetContext(r).ID
+		now := time.Now()
+
+		for i, update := range updates {
+			if results[i].Status == "error" {
+				continue
+			}
+
+			id := bson.ObjectIdHex(update.ID)
+
+			if !exists[id] {
+				results[i].Status = "error"
+				results[i].Message = "Electrician not found"
+				continue
+			}
+
+			bulk.Update(activeID(id), bson.M{
+				"$set":   bson.M{"location": geo{Type: "Point", Coordinates: update.Coordinates}, "geocodeSource": geocodeSourceGeocoded, "updatedAt": now, "updatedBy": userID},
+				"$unset": bson.M{"geocodeFailedAt": ""},
+				"$inc":   bson.M{"version": 1},
+			})
+			operations = append(operations, i)
+			results[i].Status = "updated"
+		}
+
+		if len(operations) > 0 {
+			_, err = bulk.Run()
+		}
+
+		if bulkErr, ok := err.(*mgo.BulkError); ok {
+			for _, failed := range bulkErr.Cases() {
+				if failed.Index >= 0 && failed.Index < len(operations) {
+					i := operations[failed.Index]
+					results[i].Status = "error"
+					results[i].Message = failed.Err.Error()
+				}
+			}
+		} else if err != nil {
+			errorWithJSON(w, "Database error", http.StatusInternalServerError)
+			log.Println("Failed update coordinates: ", err)
+			return
+		}
+
+		jsonData, err := json.Marshal(results)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		responseWithJSON(w, jsonData, http.StatusOK)
+	}
+}
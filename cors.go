@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// corsRule allows cross-origin requests from Origins to the routes named in
+// Routes, or every route when empty, using Methods, or every method when
+// empty. "*" in Origins allows any origin.
+type corsRule struct {
+	Routes           []string `json:"routes"`
+	Methods          []string `json:"methods"`
+	Origins          []string `json:"origins"`
+	AllowHeaders     []string `json:"allowHeaders"`
+	AllowCredentials bool     `json:"allowCredentials"`
+	MaxAge           int      `json:"maxAge"`
+}
+
+// corsRules are checked in order and the first rule matching the route and
+// method decides whether the origin is allowed.
+var corsRules []corsRule
+
+var defaultCORSHeaders = []string{"Authorization", "Content-Type", "Idempotency-Key", "Prefer", "X-Write-Concern"}
+
+// initCORS reads the rules from the JSON array at CORS_CONFIG_FILE, e.g.
+// public reads from any origin and writes only from the admin console:
+//
+//	[{"methods": ["GET"], "origins": ["*"]},
+//	 {"methods": ["POST", "DELETE"], "origins": ["https://admin.example.no"], "allowCredentials": true}]
+func initCORS() {
+	path := os.Getenv("CORS_CONFIG_FILE")
+
+	if path == "" {
+		return
+	}
+
+	data, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		panic(err)
+	}
+
+	err = json.Unmarshal(data, &corsRules)
+
+	if err != nil {
+		panic(err)
+	}
+}
+
+func (rule corsRule) matches(route string, method string) bool {
+	return (len(rule.Routes) == 0 || containsString(rule.Routes, route)) &&
+		(len(rule.Methods) == 0 || containsString(rule.Methods, method))
+}
+
+func (rule corsRule) allowsOrigin(origin string) bool {
+	return containsString(rule.Origins, "*") || containsString(rule.Origins, origin)
+}
+
+// findCORSRule returns the first rule for the route and method of r.
+func findCORSRule(router *mux.Router, r *http.Request, method string) (corsRule, bool) {
+	target := r.WithContext(r.Context())
+	target.Method = method
+
+	var match mux.RouteMatch
+	route := ""
+
+	if router.Match(target, &match) {
+		route = match.Route.GetName()
+	}
+
+	for _, rule := range corsRules {
+		if rule.matches(route, method) {
+			return rule, true
+		}
+	}
+
+	return corsRule{}, false
+}
+
+// withCORS sets CORS headers on requests from an origin allowed by the
+// matching rule and answers preflight requests. Requests from other origins
+// get no CORS headers, so browsers block them.
+func withCORS(router *mux.Router, next http.Handler) http.Handler {
+	if len(corsRules) == 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Origin")
+
+		method := r.Method
+		requestedMethod := r.Header.Get("Access-Control-Request-Method")
+		preflight := r.Method == "OPTIONS" && requestedMethod != ""
+
+		if preflight {
+			method = requestedMethod
+		}
+
+		rule, ok := findCORSRule(router, r, method)
+
+		if !ok || !rule.allowsOrigin(origin) {
+			if preflight {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if rule.AllowCredentials {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		} else if containsString(rule.Origins, "*") {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		} else {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+
+		if !preflight {
+			w.Header().Set("Access-Control-Expose-Headers", "Location, X-Total-Count, X-Total-Count-Estimated, X-Total-Pages, X-Page, X-Page-Size, X-Request-Id, X-RateLimit-Limit, X-RateLimit-Remaining, X-RateLimit-Reset")
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		allowHeaders := rule.AllowHeaders
+
+		if len(allowHeaders) == 0 {
+			allowHeaders = defaultCORSHeaders
+		}
+
+		w.Header().Set("Access-Control-Allow-Methods", method)
+		w.Header().Set("Access-Control-Allow-Headers", strings.Join(allowHeaders, ", "))
+
+		if rule.MaxAge > 0 {
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(rule.MaxAge))
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	countModeExact    string = "exact"
+	countModeEstimate string = "estimate"
+	countModeNone     string = "none"
+	countModeApprox   string = "approximate"
+
+	// approxCountLimit bounds the work of an approximate count. Aggregation
+	// explain output has no result counts, so the count stops here instead.
+	approxCountLimit int = 1000
+)
+
+func validCountMode(mode string) bool {
+	return mode == countModeExact || mode == countModeEstimate || mode == countModeNone || mode == countModeApprox
+}
+
+// countTotal counts the documents matched by pipes. The estimate mode ignores
+// the filter and returns the collection count from metadata, which is cheap on
+// huge collections but only accurate for unfiltered queries. The approximate
+// mode stops counting at approxCountLimit. approximate is true unless the
+// count is exact.
+func countTotal(c *mgo.Collection, pipes []bson.M, mode string) (total int, approximate bool, err error) {
+	if mode == countModeEstimate {
+		total, err = c.Count()
+		return total, true, err
+	}
+
+	stages := pipes[:len(pipes):len(pipes)]
+
+	if mode == countModeApprox {
+		stages = append(stages, bson.M{"$limit": approxCountLimit})
+	}
+
+	var result struct {
+		Total int `bson:"total"`
+	}
+
+	err = c.Pipe(append(stages, bson.M{"$count": "total"})).One(&result)
+
+	if err == mgo.ErrNotFound {
+		err = nil
+	}
+
+	return result.Total, mode == countModeApprox && result.Total >= approxCountLimit, err
+}
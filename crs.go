@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+)
+
+const defaultCRS string = "EPSG:4326"
+
+type projection func(lon, lat float64) (x, y float64)
+
+// projections are the supported output coordinate reference systems. Stored
+// coordinates are WGS84, which ETRS89 matches to within a metre in Norway.
+var projections = map[string]projection{
+	"EPSG:3857":  webMercator,
+	"EPSG:25832": utm(32),
+	"EPSG:25833": utm(33),
+	"EPSG:25835": utm(35),
+	"EPSG:32632": utm(32),
+	"EPSG:32633": utm(33),
+	"EPSG:32635": utm(35),
+}
+
+func lookupProjection(crs string) (projection, error) {
+	crs = strings.ToUpper(strings.TrimSpace(crs))
+
+	if crs == "" || crs == defaultCRS {
+		return nil, nil
+	}
+
+	project, ok := projections[crs]
+
+	if !ok {
+		return nil, fmt.Errorf("crs must be EPSG:4326, EPSG:3857, EPSG:25832, EPSG:25833, EPSG:25835, EPSG:32632, EPSG:32633 or EPSG:32635")
+	}
+
+	return project, nil
+}
+
+func webMercator(lon, lat float64) (float64, float64) {
+	const radius = 6378137
+	return radius * lon * math.Pi / 180, radius * math.Log(math.Tan(math.Pi/4+lat*math.Pi/360))
+}
+
+// utm returns the transverse Mercator projection for a UTM zone on the
+// WGS84/GRS80 ellipsoid, using the series expansion from USGS Professional
+// Paper 1395, accurate to millimetres within the zone.
+func utm(zone int) projection {
+	const (
+		a  = 6378137.0
+		f  = 1 / 298.257223563
+		k0 = 0.9996
+	)
+
+	e2 := f * (2 - f)
+	ep2 := e2 / (1 - e2)
+	lon0 := float64(zone*6-183) * math.Pi / 180
+
+	return func(lon, lat float64) (float64, float64) {
+		phi := lat * math.Pi / 180
+		sin, cos, tan := math.Sin(phi), math.Cos(phi), math.Tan(phi)
+
+		n := a / math.Sqrt(1-e2*sin*sin)
+		t := tan * tan
+		c := ep2 * cos * cos
+		A := cos * (lon*math.Pi/180 - lon0)
+
+		m := a * ((1-e2/4-3*e2*e2/64-5*e2*e2*e2/256)*phi -
+			(3*e2/8+3*e2*e2/32+45*e2*e2*e2/1024)*math.Sin(2*phi) +
+			(15*e2*e2/256+45*e2*e2*e2/1024)*math.Sin(4*phi) -
+			(35*e2*e2*e2/3072)*math.Sin(6*phi))
+
+		x := k0*n*(A+(1-t+c)*math.Pow(A, 3)/6+(5-18*t+t*t+72*c-58*ep2)*math.Pow(A, 5)/120) + 500000
+		y := k0 * (m + n*tan*(A*A/2+(5-t+9*c+4*c*c)*math.Pow(A, 4)/24+(61-58*t+t*t+600*c-330*ep2)*math.Pow(A, 6)/720))
+
+		if lat < 0 {
+			y += 10000000
+		}
+
+		return x, y
+	}
+}
+
+// projectCoordinates returns lon/lat coordinates in the crs requested by r.
+// It returns a new slice so shared records are left untouched.
+func projectCoordinates(r *http.Request, coordinates []float64) []float64 {
+	project, err := lookupProjection(r.URL.Query().Get("crs"))
+
+	if err != nil || project == nil || len(coordinates) != 2 {
+		return coordinates
+	}
+
+	x, y := project(coordinates[0], coordinates[1])
+	return []float64{x, y}
+}
+
+// checkCRS rejects requests for an unsupported crs and names the crs of the
+// response coordinates in the Content-Crs header.
+func checkCRS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries := r.URL.Query()
+
+		crsQuery, ok := queries["crs"]
+		if ok {
+			if len(crsQuery) > 0 {
+				project, err := lookupProjection(crsQuery[0])
+
+				if err != nil {
+					errorWithJSON(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+
+				if project != nil && queries.Get("coordFormat") == coordFormatObject {
+					errorWithJSON(w, "coordFormat=object requires crs "+defaultCRS, http.StatusBadRequest)
+					return
+				}
+
+				w.Header().Set("Content-Crs", strings.ToUpper(crsQuery[0]))
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+
+	"gopkg.in/mgo.v2"
+)
+
+func dial(uri string) (*mgo.Session, error) {
+	if os.Getenv("DB_TLS") != "true" {
+		return mgo.Dial(uri)
+	}
+
+	dialInfo, err := mgo.ParseURL(uri)
+
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{}
+
+	if caPath := os.Getenv("DB_CA_CERT"); caPath != "" {
+		pem, err := ioutil.ReadFile(caPath)
+
+		if err != nil {
+			return nil, err
+		}
+
+		roots := x509.NewCertPool()
+
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("No certificates found in %v", caPath)
+		}
+
+		tlsConfig.RootCAs = roots
+	}
+
+	dialInfo.DialServer = func(addr *mgo.ServerAddr) (net.Conn, error) {
+		return tls.Dial("tcp", addr.String(), tlsConfig)
+	}
+
+	return mgo.DialWithInfo(dialInfo)
+}
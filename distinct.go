@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	defaultDistinctLimit int = 50
+	maxDistinctLimit     int = 1000
+)
+
+// distinctValues lists the distinct non-empty values of field in
+// alphabetical order, optionally only those starting with prefix, for
+// filter dropdowns and autocomplete.
+func distinctValues(s *mgo.Session, field string) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session := readSession(s)
+		defer session.Close()
+
+		queries := r.URL.Query()
+		skip, limit := 0, defaultDistinctLimit
+		var err error
+
+		if value := queries.Get("skip"); value != "" {
+			skip, err = strconv.Atoi(value)
+
+			if err != nil || skip < 0 {
+				errorWithJSON(w, "skip must be 0 or greater", http.StatusBadRequest)
+				return
+			}
+		}
+
+		if value := queries.Get("limit"); value != "" {
+			limit, err = strconv.Atoi(value)
+
+			if err != nil || limit < 1 || limit > maxDistinctLimit {
+				errorWithJSON(w, "limit must be between 1 and 1000", http.StatusBadRequest)
+				return
+			}
+		}
+
+		match := notDeleted()
+		match[field] = bson.M{"$nin": []interface{}{"", nil}}
+
+		if prefix := queries.Get("prefix"); prefix != "" {
+			for lower, pattern := range prefixQuery(field, prefix) {
+				match[lower] = pattern
+			}
+		}
+
+		pipes := []bson.M{
+			{"$match": match},
+			{"$group": bson.M{"_id": "$" + field}},
+			{"$sort": bson.M{"_id": 1}},
+			{"$skip": skip},
+			{"$limit": limit},
+		}
+
+		var found []struct {
+			Value string `bson:"_id"`
+		}
+
+		c := session.DB(os.Getenv("DB_NAME")).C(collection)
+		started := time.Now()
+		err = c.Pipe(pipes).All(&found)
+		logSlowQuery("distinct "+field, pipes, started)
+
+		if err != nil {
+			errorWithJSON(w, "Database error", http.StatusInternalServerError)
+			log.Println("Failed get distinct values: ", err)
+			return
+		}
+
+		values := make([]string, 0, len(found))
+
+		for _, f := range found {
+			values = append(values, f.Value)
+		}
+
+		jsonData, err := json.Marshal(values)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		responseWithJSON(w, jsonData, http.StatusOK)
+	}
+}
+
+const defaultSuggestLimit int = 5
+
+type citySuggestion struct {
+	City     string `json:"city"`
+	Distance int    `json:"distance"`
+	Count    int    `json:"count"`
+}
+
+// suggestCities ranks the distinct cities by edit distance to q, then by how
+// many records use them, so the likely correct spelling of a typo comes
+// first. q itself is left out.
+func suggestCities(s *mgo.Session) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session := readSession(s)
+		defer session.Close()
+
+		queries := r.URL.Query()
+		q := strings.ToLower(strings.TrimSpace(queries.Get("q")))
+
+		if q == "" {
+			errorWithJSON(w, "q is required", http.StatusBadRequest)
+			return
+		}
+
+		limit := defaultSuggestLimit
+
+		if value := queries.Get("limit"); value != "" {
+			var err error
+			limit, err = strconv.Atoi(value)
+
+			if err != nil || limit < 1 || limit > maxDistinctLimit {
+				errorWithJSON(w, "limit must be between 1 and 1000", http.StatusBadRequest)
+				return
+			}
+		}
+
+		match := notDeleted()
+		match["city"] = bson.M{"$nin": []interface{}{"", nil}}
+		pipes := []bson.M{
+			{"$match": match},
+			{"$group": bson.M{"_id": "$city", "count": bson.M{"$sum": 1}}},
+		}
+
+		var cities []struct {
+			City  string `bson:"_id"`
+			Count int    `bson:"count"`
+		}
+
+		c := session.DB(os.Getenv("DB_NAME")).C(collection)
+		started := time.Now()
+		err := c.Pipe(pipes).All(&cities)
+		logSlowQuery("suggest cities", pipes, started)
+
+		if err != nil {
+			errorWithJSON(w, "Database error", http.StatusInternalServerError)
+			log.Println("Failed get cities: ", err)
+			return
+		}
+
+		suggestions := make([]citySuggestion, 0)
+
+		for _, city := range cities {
+			name := strings.ToLower(city.City)
+
+			if name == q {
+				continue
+			}
+
+			if distance := levenshtein(q, name); distance <= maxTypos(q) {
+				suggestions = append(suggestions, citySuggestion{City: city.City, Distance: distance, Count: city.Count})
+			}
+		}
+
+		sort.Slice(suggestions, func(i, j int) bool {
+			if suggestions[i].Distance != suggestions[j].Distance {
+				return suggestions[i].Distance < suggestions[j].Distance
+			}
+
+			return suggestions[i].Count > suggestions[j].Count
+		})
+
+		if len(suggestions) > limit {
+			suggestions = suggestions[:limit]
+		}
+
+		jsonData, err := json.Marshal(suggestions)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		responseWithJSON(w, jsonData, http.StatusOK)
+	}
+}
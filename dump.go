@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+
+	"gopkg.in/mgo.v2"
+)
+
+const dumpFlushEvery int = 100
+
+// dump streams every record, soft-deleted ones included, as newline-delimited
+// JSON. Errors after the first record can only be logged since the status has
+// already been sent.
+func dump(s *mgo.Session) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session := streamSession(s)
+		defer session.Close()
+
+		c := session.DB(os.Getenv("DB_NAME")).C(collection)
+		iter := c.Find(nil).Sort("_id").Iter()
+
+		w.Header().Set("Content-Type", "application/x-ndjson; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+
+		flusher, _ := w.(http.Flusher)
+		encoder := json.NewEncoder(w)
+
+		var e electrician
+		count := 0
+
+		for iter.Next(&e) {
+			err := encoder.Encode(e)
+
+			if err != nil {
+				log.Println("Failed write dump: ", err)
+				iter.Close()
+				return
+			}
+
+			e = electrician{}
+			count++
+
+			if count%dumpFlushEvery == 0 && clientGone(r) {
+				iter.Close()
+				return
+			}
+
+			if flusher != nil && count%dumpFlushEvery == 0 {
+				flusher.Flush()
+			}
+		}
+
+		err := iter.Close()
+
+		if err != nil {
+			log.Println("Failed dump electricians: ", err)
+		}
+	}
+}
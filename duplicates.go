@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	defaultDuplicatesLimit int = 50
+	maxDuplicatesLimit     int = 1000
+)
+
+type duplicateGroup struct {
+	Key          string        `json:"key" bson:"_id"`
+	Count        int           `json:"count" bson:"count"`
+	Electricians []electrician `json:"electricians" bson:"electricians"`
+}
+
+// duplicateKeys are the expressions records are grouped by. Phone numbers are
+// normalized when written, and names are compared trimmed and lower-cased.
+var duplicateKeys = map[string]struct {
+	Match bson.M
+	Key   interface{}
+}{
+	"phone": {
+		Match: bson.M{"phone": bson.M{"$nin": []interface{}{"", nil}}},
+		Key:   "$phone",
+	},
+	"nameZip": {
+		Match: bson.M{"name": bson.M{"$nin": []interface{}{"", nil}}},
+		Key: bson.M{"$concat": []interface{}{
+			bson.M{"$toLower": bson.M{"$trim": bson.M{"input": "$name"}}},
+			"|",
+			bson.M{"$trim": bson.M{"input": bson.M{"$ifNull": []interface{}{"$zip", ""}}}},
+		}},
+	},
+}
+
+// duplicates lists groups of records sharing a key, ordered by key. The
+// grouping runs in the database and is paged with skip and limit.
+func duplicates(s *mgo.Session) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session := readSession(s)
+		defer session.Close()
+
+		queries := r.URL.Query()
+		by := queries.Get("by")
+
+		if by == "" {
+			by = "phone"
+		}
+
+		key, ok := duplicateKeys[by]
+
+		if !ok {
+			errorWithJSON(w, "by must be phone or nameZip", http.StatusBadRequest)
+			return
+		}
+
+		skip, limit := 0, defaultDuplicatesLimit
+		var err error
+
+		if value := queries.Get("skip"); value != "" {
+			skip, err = strconv.Atoi(value)
+
+			if err != nil || skip < 0 {
+				errorWithJSON(w, "skip must be 0 or greater", http.StatusBadRequest)
+				return
+			}
+		}
+
+		if value := queries.Get("limit"); value != "" {
+			limit, err = strconv.Atoi(value)
+
+			if err != nil || limit < 1 || limit > maxDuplicatesLimit {
+				errorWithJSON(w, "limit must be between 1 and 1000", http.StatusBadRequest)
+				return
+			}
+		}
+
+		match := notDeleted()
+
+		for field, condition := range key.Match {
+			match[field] = condition
+		}
+
+		pipes := []bson.M{
+			{"$match": match},
+			{"$group": bson.M{
+				"_id":          key.Key,
+				"count":        bson.M{"$sum": 1},
+				"electricians": bson.M{"$push": "$$ROOT"},
+			}},
+			{"$match": bson.M{"count": bson.M{"$gt": 1}}},
+			{"$sort": bson.M{"_id": 1}},
+			{"$skip": skip},
+			{"$limit": limit},
+		}
+
+		result := make([]duplicateGroup, 0)
+
+		c := session.DB(os.Getenv("DB_NAME")).C(collection)
+		started := time.Now()
+		err = c.Pipe(pipes).AllowDiskUse().All(&result)
+		logSlowQuery("duplicates", pipes, started)
+
+		if err != nil {
+			errorWithJSON(w, "Database error", http.StatusInternalServerError)
+			log.Println("Failed find duplicates: ", err)
+			return
+		}
+
+		jsonData, err := json.Marshal(result)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		responseWithJSON(w, jsonData, http.StatusOK)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// envelopeMediaType requests search results wrapped with their paging
+// metadata instead of as a bare array.
+const envelopeMediaType string = "application/vnd.electricians.envelope+json"
+
+type searchEnvelope struct {
+	Data           json.RawMessage `json:"data"`
+	Total          *int            `json:"total,omitempty"`
+	TotalEstimated bool            `json:"totalEstimated,omitempty"`
+	Skip           int             `json:"skip"`
+	Limit          int             `json:"limit"`
+	Page           int             `json:"page,omitempty"`
+	PageSize       int             `json:"pageSize,omitempty"`
+	TotalPages     *int            `json:"totalPages,omitempty"`
+}
+
+// envelopeByDefault is set by SEARCH_ENVELOPE_DEFAULT=true once clients have
+// moved to the envelope, so the bare array can be phased out. envelope=false
+// still returns the bare array until then.
+var envelopeByDefault = false
+
+func initSearchEnvelope() {
+	value := os.Getenv("SEARCH_ENVELOPE_DEFAULT")
+
+	if value == "" {
+		return
+	}
+
+	enabled, err := strconv.ParseBool(value)
+
+	if err != nil {
+		panic("SEARCH_ENVELOPE_DEFAULT must be true or false")
+	}
+
+	envelopeByDefault = enabled
+}
+
+// deprecateBareResults marks search results sent without the envelope as
+// deprecated.
+func deprecateBareResults(w http.ResponseWriter) {
+	w.Header().Set("Deprecation", "true")
+	w.Header().Set("Warning", `299 - "Search results without an envelope are deprecated, request envelope=true or Accept: `+envelopeMediaType+`"`)
+}
+
+func wantsEnvelope(r *http.Request) bool {
+	if value := r.URL.Query().Get("envelope"); value != "" {
+		envelope, err := strconv.ParseBool(value)
+		return err == nil && envelope
+	}
+
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, _ := mime.ParseMediaType(strings.TrimSpace(accept))
+
+		if mediaType == envelopeMediaType {
+			return true
+		}
+	}
+
+	return envelopeByDefault
+}
+
+// envelopeResults wraps search results with the paging metadata already set
+// in the X-Total-Count and X-Page headers.
+func envelopeResults(w http.ResponseWriter, params searchParams, data []byte) ([]byte, error) {
+	envelope := searchEnvelope{
+		Data:           data,
+		TotalEstimated: w.Header().Get("X-Total-Count-Estimated") == "true",
+		Skip:           params.Skip,
+		Limit:          params.Limit,
+		Page:           params.Page,
+		PageSize:       params.PageSize,
+	}
+
+	if total, err := strconv.Atoi(w.Header().Get("X-Total-Count")); err == nil {
+		envelope.Total = &total
+	}
+
+	if totalPages, err := strconv.Atoi(w.Header().Get("X-Total-Pages")); err == nil {
+		envelope.TotalPages = &totalPages
+	}
+
+	return json.Marshal(envelope)
+}
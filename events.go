@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"gopkg.in/mgo.v2"
+)
+
+const (
+	eventPollInterval  = 2 * time.Second
+	eventKeepAlive     = 15 * time.Second
+	eventPollBatchSize = 500
+)
+
+type eventSubscriber struct {
+	events chan webhookEvent
+	bbox   *[4]float64
+}
+
+// eventHub polls updatedAt for changes, since mgo.v2 has no change streams,
+// and fans them out to /events subscribers. Polling through the database
+// rather than hooking into handlers means writes from every instance are seen.
+type eventHub struct {
+	mu          sync.Mutex
+	session     *mgo.Session
+	subscribers map[*eventSubscriber]bool
+	start       sync.Once
+}
+
+var events = &eventHub{subscribers: make(map[*eventSubscriber]bool)}
+
+// maxEventSubscribers caps open /events streams, which are exempt from the
+// handler timeout and the concurrency limit.
+var maxEventSubscribers = 100
+
+func initEventSubscribers() {
+	value := os.Getenv("MAX_EVENT_SUBSCRIBERS")
+
+	if value == "" {
+		return
+	}
+
+	limit, err := strconv.Atoi(value)
+
+	if err != nil {
+		panic(err)
+	}
+
+	maxEventSubscribers = limit
+}
+
+// subscribe returns nil when maxEventSubscribers are already listening.
+func (hub *eventHub) subscribe(s *mgo.Session, bbox *[4]float64) *eventSubscriber {
+	hub.start.Do(func() {
+		hub.session = s
+		go hub.poll()
+	})
+
+	subscriber := &eventSubscriber{events: make(chan webhookEvent, 64), bbox: bbox}
+
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	if len(hub.subscribers) >= maxEventSubscribers {
+		return nil
+	}
+
+	hub.subscribers[subscriber] = true
+	return subscriber
+}
+
+func (hub *eventHub) unsubscribe(subscriber *eventSubscriber) {
+	hub.mu.Lock()
+	delete(hub.subscribers, subscriber)
+	hub.mu.Unlock()
+}
+
+func (hub *eventHub) hasSubscribers() bool {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	return len(hub.subscribers) > 0
+}
+
+func (hub *eventHub) publish(event webhookEvent) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	for subscriber := range hub.subscribers {
+		location := event.Electrician.Location.Coordinates
+
+		if subscriber.bbox != nil && (len(location) != 2 || !inBBox(*subscriber.bbox, location[0], location[1])) {
+			continue
+		}
+
+		select {
+		case subscriber.events <- event:
+		default:
+			log.Println("Dropping event for slow /events subscriber: ", event.ID)
+		}
+	}
+}
+
+// projectedEvent is a webhookEvent with the electrician reduced to the
+// response fields of the subscriber.
+type projectedEvent struct {
+	Type        string          `json:"type"`
+	ID          string          `json:"id"`
+	Electrician json.RawMessage `json:"electrician"`
+}
+
+func changeEvent(e electrician) webhookEvent {
+	eventType := "updated"
+
+	if e.DeletedAt != nil {
+		eventType = "deleted"
+	} else if e.CreatedAt.Equal(e.UpdatedAt) {
+		eventType = "created"
+	}
+
+	return webhookEvent{Type: eventType, ID: e.ID.Hex(), Electrician: &e}
+}
+
+// poll follows the /changes cursor, so records sharing a timestamp are paged
+// through by id however many there are.
+func (hub *eventHub) poll() {
+	cursor := changeCursor{UpdatedAt: time.Now()}
+
+	for range time.Tick(eventPollInterval) {
+		if !hub.hasSubscribers() {
+			cursor = changeCursor{UpdatedAt: time.Now()}
+			continue
+		}
+
+		session := hub.session.Copy()
+		var changed []electrician
+
+		err := session.DB(os.Getenv("DB_NAME")).C(collection).
+			Find(cursor.after()).
+			Sort("updatedAt", "_id").Limit(eventPollBatchSize).All(&changed)
+		session.Close()
+
+		if err != nil {
+			log.Println("Failed poll changes: ", err)
+			continue
+		}
+
+		for _, e := range changed {
+			cursor = changeCursor{UpdatedAt: e.UpdatedAt, ID: e.ID}
+			hub.publish(changeEvent(e))
+		}
+	}
+}
+
+// streamEvents sends change events as server-sent events, optionally only
+// those inside bbox, with a comment every eventKeepAlive to keep proxies
+// from closing the connection.
+func streamEvents(s *mgo.Session) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+
+		if !ok {
+			errorWithJSON(w, "Streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+
+		var bbox *[4]float64
+
+		if value := r.URL.Query().Get("bbox"); value != "" {
+			parsed, err := parseBBox(value)
+
+			if err != nil {
+				errorWithJSON(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			bbox = &parsed
+		}
+
+		subscriber := events.subscribe(s, bbox)
+
+		if subscriber == nil {
+			w.Header().Set("Retry-After", "30")
+			errorWithJSON(w, "Too many event subscribers", http.StatusServiceUnavailable)
+			return
+		}
+
+		defer events.unsubscribe(subscriber)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		fields := responseFields(r)
+		keepAlive := time.NewTicker(eventKeepAlive)
+		defer keepAlive.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-keepAlive.C:
+				fmt.Fprint(w, ": keep-alive\n\n")
+				flusher.Flush()
+			case event := <-subscriber.events:
+				// Subscribers share the event, so prepare a copy.
+				e := *event.Electrician
+				prepareElectrician(r, &e)
+				electricianJSON, err := marshalFields(e, fields)
+
+				if err != nil {
+					log.Fatal(err)
+				}
+
+				jsonData, err := json.Marshal(projectedEvent{Type: event.Type, ID: event.ID, Electrician: electricianJSON})
+
+				if err != nil {
+					log.Fatal(err)
+				}
+
+				fmt.Fprintf(w, "event: %v\nid: %v\ndata: %s\n\n", event.Type, event.ID, jsonData)
+				flusher.Flush()
+			}
+		}
+	}
+}
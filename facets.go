@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// maxFacetValues caps the values returned per facet, most frequent first.
+const maxFacetValues int = 50
+
+// facetFields are the fields search can count values of.
+var facetFields = map[string]bool{
+	"city":     true,
+	"county":   true,
+	"zip":      true,
+	"tags":     true,
+	"language": true,
+}
+
+type facetCount struct {
+	Value interface{} `json:"value" bson:"_id"`
+	Count int         `json:"count" bson:"count"`
+}
+
+type facetResult struct {
+	Results []electrician
+	Facets  map[string][]facetCount
+}
+
+func parseFacets(value string) ([]string, error) {
+	var facets []string
+
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+
+		if !facetFields[field] {
+			return nil, fmt.Errorf("facets must be comma-separated fields from city, county, zip, tags and language")
+		}
+
+		facets = append(facets, field)
+	}
+
+	return facets, nil
+}
+
+// facetSearch returns a page of the records matched by pipes together with
+// the value counts of each facet field across all matches, in one $facet
+// aggregation.
+func facetSearch(c *mgo.Collection, pipes []bson.M, skip int, limit int, facets []string) (facetResult, error) {
+	stages := bson.M{"results": []bson.M{{"$skip": skip}, {"$limit": limit}}}
+
+	for _, field := range facets {
+		var count []bson.M
+
+		if field == "tags" {
+			count = append(count, bson.M{"$unwind": "$tags"})
+		}
+
+		count = append(count,
+			bson.M{"$match": bson.M{field: bson.M{"$nin": []interface{}{"", nil}}}},
+			bson.M{"$sortByCount": "$" + field},
+			bson.M{"$limit": maxFacetValues},
+		)
+
+		stages[field] = count
+	}
+
+	result := facetResult{Results: make([]electrician, 0), Facets: make(map[string][]facetCount)}
+
+	var found map[string]bson.Raw
+	err := c.Pipe(append(pipes[:len(pipes):len(pipes)], bson.M{"$facet": stages})).One(&found)
+
+	if err != nil {
+		return result, err
+	}
+
+	err = found["results"].Unmarshal(&result.Results)
+
+	for _, field := range facets {
+		counts := make([]facetCount, 0)
+
+		if err == nil {
+			err = found[field].Unmarshal(&counts)
+		}
+
+		result.Facets[field] = counts
+	}
+
+	return result, err
+}
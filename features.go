@@ -0,0 +1,38 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// disabledEndpoints holds the route names listed in DISABLED_ENDPOINTS.
+var disabledEndpoints = map[string]bool{}
+
+func initDisabledEndpoints() {
+	for _, name := range strings.Split(os.Getenv("DISABLED_ENDPOINTS"), ",") {
+		name = strings.TrimSpace(name)
+
+		if name != "" {
+			disabledEndpoints[name] = true
+			log.Println("Endpoint disabled: ", name)
+		}
+	}
+}
+
+// featureFlags responds 404 to requests for routes named in DISABLED_ENDPOINTS.
+func featureFlags(router *mux.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var match mux.RouteMatch
+
+		if len(disabledEndpoints) > 0 && router.Match(r, &match) && disabledEndpoints[match.Route.GetName()] {
+			errorWithJSON(w, "endpoint_disabled", http.StatusNotFound)
+			return
+		}
+
+		router.ServeHTTP(w, r)
+	})
+}
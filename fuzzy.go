@@ -0,0 +1,128 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Fuzzy search scans up to fuzzyCandidateLimit records matching the other
+// filters and ranks their names by edit distance in memory. It finds typos the
+// text index misses but gets slower and less complete as the collection grows.
+const fuzzyCandidateLimit int = 5000
+
+type fuzzyMatch struct {
+	electrician electrician
+	distance    int
+}
+
+func levenshtein(a, b string) int {
+	ar, br := []rune(a), []rune(b)
+	prev := make([]int, len(br)+1)
+	curr := make([]int, len(br)+1)
+
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ar); i++ {
+		curr[0] = i
+
+		for j := 1; j <= len(br); j++ {
+			cost := 1
+
+			if ar[i-1] == br[j-1] {
+				cost = 0
+			}
+
+			curr[j] = minInt(minInt(prev[j]+1, curr[j-1]+1), prev[j-1]+cost)
+		}
+
+		prev, curr = curr, prev
+	}
+
+	return prev[len(br)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
+
+func maxTypos(term string) int {
+	if utf8.RuneCountInString(term) <= 4 {
+		return 1
+	}
+
+	return 2
+}
+
+// fuzzyDistance sums, for each query term, the distance to the closest word in
+// name. ok is false when any term is too far from every word.
+func fuzzyDistance(query, name string) (distance int, ok bool) {
+	words := strings.Fields(strings.ToLower(name))
+
+	if len(words) == 0 {
+		return 0, false
+	}
+
+	for _, term := range strings.Fields(strings.ToLower(query)) {
+		best := -1
+
+		for _, word := range words {
+			d := levenshtein(term, word)
+
+			if best == -1 || d < best {
+				best = d
+			}
+		}
+
+		if best > maxTypos(term) {
+			return 0, false
+		}
+
+		distance += best
+	}
+
+	return distance, true
+}
+
+func fuzzySearch(c *mgo.Collection, params searchParams) ([]electrician, int, error) {
+	text := params.Text
+	params.Text = ""
+
+	var candidates []electrician
+
+	pipes := append(buildSearchPipes(params), bson.M{"$limit": fuzzyCandidateLimit})
+	err := c.Pipe(pipes).All(&candidates)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var matches []fuzzyMatch
+
+	for _, candidate := range candidates {
+		if distance, ok := fuzzyDistance(text, candidate.Name); ok {
+			matches = append(matches, fuzzyMatch{candidate, distance})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].distance < matches[j].distance
+	})
+
+	result := make([]electrician, 0)
+
+	for i := params.Skip; i < len(matches) && len(result) < params.Limit; i++ {
+		result = append(result, matches[i].electrician)
+	}
+
+	return result, len(matches), nil
+}
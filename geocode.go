@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stianba/auth-service/token"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	defaultGeocodeBatch int = 100
+	geocoderTimeout         = 10 * time.Second
+
+	// geocodeSource tells clients whether coordinates can be trusted or are
+	// an approximation from geocoding the address.
+	geocodeSourceUser     string = "user"
+	geocodeSourceGeocoded string = "geocoded"
+)
+
+type geocodeSummary struct {
+	Processed int `json:"processed"`
+	Succeeded int `json:"succeeded"`
+	Failed    int `json:"failed"`
+	Remaining int `json:"remaining"`
+}
+
+var geocoderClient = &http.Client{Timeout: geocoderTimeout}
+
+// geocoderInterval spaces out geocoder calls according to GEOCODER_RATE
+// (requests per second, default 1 as required by public Nominatim).
+func geocoderInterval() time.Duration {
+	rate, err := strconv.ParseFloat(os.Getenv("GEOCODER_RATE"), 64)
+
+	if err != nil || rate <= 0 {
+		rate = 1
+	}
+
+	return time.Duration(float64(time.Second) / rate)
+}
+
+func geocodeQuery(e electrician) string {
+	var parts []string
+
+	for _, part := range []string{e.AddressLine1, e.Zip, e.City, e.County} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// geocode looks up coordinates for an address using the Nominatim-compatible
+// search API at GEOCODER_URL.
+func geocode(address string) ([]float64, error) {
+	geocoderURL := os.Getenv("GEOCODER_URL")
+
+	if geocoderURL == "" {
+		return nil, fmt.Errorf("No geocoder configured")
+	}
+
+	res, err := geocoderClient.Get(geocoderURL + "?format=json&limit=1&q=" + url.QueryEscape(address))
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Geocoder responded with %v", res.StatusCode)
+	}
+
+	var results []struct {
+		Lat string `json:"lat"`
+		Lon string `json:"lon"`
+	}
+
+	err = json.NewDecoder(res.Body).Decode(&results)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(results) == 0 {
+		return nil, fmt.Errorf("No geocoding result for %q", address)
+	}
+
+	lon, err := strconv.ParseFloat(results[0].Lon, 64)
+
+	if err != nil {
+		return nil, err
+	}
+
+	lat, err := strconv.ParseFloat(results[0].Lat, 64)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return []float64{lon, lat}, nil
+}
+
+// missingCoordinates matches records without coordinates that have not
+// already failed geocoding, so repeated runs pick up where the last stopped.
+func missingCoordinates(retryFailed bool) bson.M {
+	query := notDeleted()
+	query["$or"] = []bson.M{
+		{"location.coordinates": bson.M{"$exists": false}},
+		{"location.coordinates": nil},
+		{"location.coordinates": bson.M{"$size": 0}},
+	}
+
+	if !retryFailed {
+		query["geocodeFailedAt"] = bson.M{"$exists": false}
+	}
+
+	return query
+}
+
+func geocodeMissing(s *mgo.Session) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session := s.Copy()
+		defer session.Close()
+
+		if os.Getenv("GEOCODER_URL") == "" {
+			errorWithJSON(w, "No geocoder configured", http.StatusServiceUnavailable)
+			return
+		}
+
+		batch := defaultGeocodeBatch
+
+		if value := r.URL.Query().Get("batch"); value != "" {
+			i, err := strconv.Atoi(value)
+
+			if err != nil || i < 1 {
+				errorWithJSON(w, "batch must be a positive number", http.StatusBadRequest)
+				return
+			}
+
+			batch = i
+		}
+
+		query := missingCoordinates(r.URL.Query().Get("retryFailed") == "true")
+
+		var electricians []electrician
+
+		c := session.DB(os.Getenv("DB_NAME")).C(collection)
+		err := c.Find(query).Limit(batch).All(&electricians)
+
+		if err != nil {
+			errorWithJSON(w, "Database error", http.StatusInternalServerError)
+			log.Println("Failed find electricians to geocode: ", err)
+			return
+		}
+
+		var summary geocodeSummary
+
+		userID := token.GetContext(r).ID
+
+		throttle := time.NewTicker(geocoderInterval())
+		defer throttle.Stop()
+
+		for i, e := range electricians {
+			if i > 0 {
+				<-throttle.C
+			}
+
+			summary.Processed++
+
+			coordinates, err := geocode(geocodeQuery(e))
+
+			if err != nil {
+				log.Println("Failed geocode electrician: ", e.ID.Hex(), err)
+				summary.Failed++
+				c.UpdateId(e.ID, bson.M{"$set": bson.M{"geocodeFailedAt": time.Now()}})
+				continue
+			}
+
+			err = c.UpdateId(e.ID, bson.M{
+				"$set":   bson.M{"location": geo{Type: "Point", Coordinates: coordinates}, "geocodeSource": geocodeSourceGeocoded, "updatedAt": time.Now(), "updatedBy": userID},
+				"$unset": bson.M{"geocodeFailedAt": ""},
+				"$inc":   bson.M{"version": 1},
+			})
+
+			if err != nil {
+				log.Println("Failed update geocoded electrician: ", e.ID.Hex(), err)
+				summary.Failed++
+				continue
+			}
+
+			summary.Succeeded++
+		}
+
+		summary.Remaining, err = c.Find(missingCoordinates(false)).Count()
+
+		if err != nil {
+			log.Println("Failed count electricians to geocode: ", err)
+		}
+
+		jsonData, err := json.Marshal(summary)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		responseWithJSON(w, jsonData, http.StatusOK)
+	}
+}
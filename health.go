@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"gopkg.in/mgo.v2"
+)
+
+type dependencyStatus struct {
+	Status    string `json:"status"`
+	Critical  bool   `json:"critical"`
+	LatencyMs int64  `json:"latencyMs,omitempty"`
+	Message   string `json:"message,omitempty"`
+}
+
+type healthReport struct {
+	Healthy      bool                        `json:"healthy"`
+	Dependencies map[string]dependencyStatus `json:"dependencies"`
+}
+
+func checkDependency(critical bool, check func() error) dependencyStatus {
+	started := time.Now()
+	err := check()
+	status := dependencyStatus{Status: "ok", Critical: critical, LatencyMs: time.Since(started).Nanoseconds() / int64(time.Millisecond)}
+
+	if err != nil {
+		status.Status = "down"
+		status.Message = err.Error()
+	}
+
+	return status
+}
+
+// healthDetail reports each dependency. Only the database is critical; a
+// missing index or unreachable geocoder degrades the service without
+// making it unhealthy.
+func healthDetail(s *mgo.Session) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session := requestSession(s)
+		defer session.Close()
+
+		report := healthReport{Healthy: true, Dependencies: make(map[string]dependencyStatus)}
+
+		report.Dependencies["mongo"] = checkDependency(true, session.Ping)
+
+		report.Dependencies["indexes"] = checkDependency(false, func() error {
+			names, err := indexNames(session.DB(os.Getenv("DB_NAME")).C(collection))
+
+			if err != nil {
+				return err
+			}
+
+			// _id_ is not in electricianIndexes.
+			if expected := len(electricianIndexes()) + 1; len(names) < expected {
+				return fmt.Errorf("%v of %v indexes exist", len(names), expected)
+			}
+
+			return nil
+		})
+
+		if geocoderURL := os.Getenv("GEOCODER_URL"); geocoderURL != "" {
+			report.Dependencies["geocoder"] = checkDependency(false, func() error {
+				res, err := geocoderClient.Get(geocoderURL)
+
+				if err != nil {
+					return err
+				}
+
+				res.Body.Close()
+
+				if res.StatusCode >= 500 {
+					return fmt.Errorf("responded with %v", res.StatusCode)
+				}
+
+				return nil
+			})
+		}
+
+		status := http.StatusOK
+
+		for name, dependency := range report.Dependencies {
+			if dependency.Status != "ok" && dependency.Critical {
+				report.Healthy = false
+				status = http.StatusServiceUnavailable
+				log.Printf("Health check failed for %v: %v", name, dependency.Message)
+			}
+		}
+
+		jsonData, err := json.Marshal(report)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		responseWithJSON(w, jsonData, status)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"html"
+	"regexp"
+	"strings"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	defaultHighlightPre  string = "<mark>"
+	defaultHighlightPost string = "</mark>"
+)
+
+// textTerms returns the regex-quoted terms of a $text search, leaving out negations.
+func textTerms(text string) []string {
+	var terms []string
+
+	for _, term := range strings.Fields(text) {
+		term = strings.Trim(term, "\"")
+
+		if term == "" || strings.HasPrefix(term, "-") {
+			continue
+		}
+
+		terms = append(terms, regexp.QuoteMeta(term))
+	}
+
+	return terms
+}
+
+// highlightPattern builds a case-insensitive pattern matching any term of a $text search.
+func highlightPattern(text string) *regexp.Regexp {
+	terms := textTerms(text)
+
+	if len(terms) == 0 {
+		return nil
+	}
+
+	return regexp.MustCompile("(?i)(" + strings.Join(terms, "|") + ")")
+}
+
+// highlightField HTML-escapes value and wraps each match in pre and post.
+// The delimiters are inserted as given, never expanded as a template.
+func highlightField(pattern *regexp.Regexp, value, pre, post string) string {
+	var b strings.Builder
+	last := 0
+
+	for _, match := range pattern.FindAllStringIndex(value, -1) {
+		b.WriteString(html.EscapeString(value[last:match[0]]))
+		b.WriteString(pre)
+		b.WriteString(html.EscapeString(value[match[0]:match[1]]))
+		b.WriteString(post)
+		last = match[1]
+	}
+
+	b.WriteString(html.EscapeString(value[last:]))
+	return b.String()
+}
+
+func highlightElectricians(electricians []electrician, text, pre, post string) {
+	pattern := highlightPattern(text)
+
+	if pattern == nil {
+		return
+	}
+
+	for i := range electricians {
+		e := &electricians[i]
+
+		for _, field := range []*string{&e.Name, &e.AddressLine1, &e.AddressLine2, &e.City, &e.County} {
+			*field = highlightField(pattern, *field, pre, post)
+		}
+	}
+}
+
+// textRegexQuery approximates a $text search with a case-insensitive regex
+// over the text-indexed fields.
+func textRegexQuery(text string) bson.M {
+	return textFieldsQuery(bson.RegEx{Pattern: strings.Join(textTerms(text), "|"), Options: "i"})
+}
+
+// phraseRegexQuery is textRegexQuery for exactPhrase, matching the whole
+// phrase in any one text field.
+func phraseRegexQuery(text string) bson.M {
+	return textFieldsQuery(bson.RegEx{Pattern: regexp.QuoteMeta(strings.Replace(text, `"`, "", -1)), Options: "i"})
+}
+
+func textFieldsQuery(pattern bson.RegEx) bson.M {
+	fields := []string{"name", "addressLine1", "addressLine2", "city", "county"}
+	or := make([]bson.M, 0, len(fields))
+
+	for _, field := range fields {
+		or = append(or, bson.M{field: pattern})
+	}
+
+	return bson.M{"$or": or}
+}
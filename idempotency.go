@@ -0,0 +1,87 @@
+package main
+
+import (
+	"log"
+	"os"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	idempotencyCollection string = "idempotency_keys"
+	idempotencyKeyTTL            = 24 * time.Hour
+)
+
+type idempotentResponse struct {
+	Key       string    `bson:"_id"`
+	Status    int       `bson:"status"`
+	Body      []byte    `bson:"body"`
+	CreatedAt time.Time `bson:"createdAt"`
+}
+
+func ensureIdempotencyIndex(s *mgo.Session) {
+	session := s.Copy()
+	defer session.Close()
+
+	c := session.DB(os.Getenv("DB_NAME")).C(idempotencyCollection)
+
+	ttlIndex := mgo.Index{
+		Key:         []string{"createdAt"},
+		ExpireAfter: idempotencyKeyTTL,
+	}
+
+	err := c.EnsureIndex(ttlIndex)
+
+	if err != nil {
+		panic(err)
+	}
+}
+
+// reserveIdempotencyKey claims key with an insert, so of two concurrent
+// requests with the same key only one goes on to create a record. When the
+// key is already taken it returns the stored response, which has no status
+// until the request holding the key has finished.
+func reserveIdempotencyKey(session *mgo.Session, key string) (previous idempotentResponse, reserved bool, err error) {
+	c := session.DB(os.Getenv("DB_NAME")).C(idempotencyCollection)
+	err = c.Insert(idempotentResponse{Key: key, CreatedAt: time.Now()})
+
+	if err == nil {
+		reserved = true
+		return
+	}
+
+	if !mgo.IsDup(err) {
+		return
+	}
+
+	err = c.FindId(key).One(&previous)
+
+	// The reservation expired or was released in between; let the client retry.
+	if err == mgo.ErrNotFound {
+		err = nil
+	}
+
+	return
+}
+
+// releaseIdempotencyKey drops a reservation when the request failed, so a
+// retry with the same key is handled afresh.
+func releaseIdempotencyKey(session *mgo.Session, key string) {
+	c := session.DB(os.Getenv("DB_NAME")).C(idempotencyCollection)
+	err := c.RemoveId(key)
+
+	if err != nil && err != mgo.ErrNotFound {
+		log.Println("Failed to release idempotency key: ", err)
+	}
+}
+
+func saveIdempotentResponse(session *mgo.Session, key string, status int, body []byte) {
+	c := session.DB(os.Getenv("DB_NAME")).C(idempotencyCollection)
+	err := c.UpdateId(key, bson.M{"$set": bson.M{"status": status, "body": body}})
+
+	if err != nil {
+		log.Println("Failed to store idempotency key: ", err)
+	}
+}
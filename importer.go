@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/stianba/auth-service/token"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const maxImportSize int = 1000
+
+type importResult struct {
+	Index   int    `json:"index"`
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+// importUpdate builds an upsert that overwrites the record's fields but keeps
+// the id and creation audit fields of an existing record.
+func importUpdate(e electrician, userID string, now time.Time) bson.M {
+	update := bson.M{
+		"$set": bson.M{
+			"name":          e.Name,
+			"addressLine1":  e.AddressLine1,
+			"addressLine2":  e.AddressLine2,
+			"city":          e.City,
+			"county":        e.County,
+			"zip":           e.Zip,
+			"phone":         e.Phone,
+			"phones":        e.Phones,
+			"website":       e.Website,
+			"email":         e.Email,
+			"location":      e.Location,
+			"geocodeSource": e.GeocodeSource,
+			"tags":          e.Tags,
+			"language":      e.Language,
+			"rating":        e.Rating,
+			"updatedAt":     now,
+			"updatedBy":     userID,
+		},
+		"$setOnInsert": bson.M{
+			"_id":       bson.NewObjectId(),
+			"createdAt": now,
+			"createdBy": userID,
+		},
+	}
+
+	for field, value := range prefixValues(e) {
+		update["$set"].(bson.M)[field] = value
+	}
+
+	// An empty orgNumber must stay unset, or it would clash in the unique index.
+	if e.OrgNumber != "" {
+		update["$set"].(bson.M)["orgNumber"] = e.OrgNumber
+	}
+
+	if e.InternalNotes != "" {
+		update["$set"].(bson.M)["internalNotes"] = e.InternalNotes
+	}
+
+	return update
+}
+
+func importElectricians(s *mgo.Session) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session := s.Copy()
+		defer session.Close()
+
+		if err := requestWriteConcern(session, r); err != nil {
+			errorWithJSON(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var electricians []electrician
+
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&electricians)
+
+		if err != nil {
+			errorWithJSON(w, "Incorrect body", http.StatusBadRequest)
+			return
+		}
+
+		if len(electricians) > maxImportSize {
+			errorWithJSON(w, fmt.Sprintf("At most %v records can be imported at once", maxImportSize), http.StatusBadRequest)
+			return
+		}
+
+		results := make([]importResult, len(electricians))
+		phones := make([]string, 0, len(electricians))
+		seen := make(map[string]bool)
+
+		for i := range electricians {
+			e := &electricians[i]
+			syncPhones(e)
+			syncPrefixFields(e)
+			e.OrgNumber = normalizeOrgNumber(e.OrgNumber)
+			e.Location.Type = "Point"
+			e.GeocodeSource = ""
+
+			if len(e.Location.Coordinates) > 0 {
+				e.GeocodeSource = geocodeSourceUser
+			}
+
+			if language, ok := textLanguage(e.Language); ok {
+				e.Language = language
+			}
+
+			results[i] = importResult{Index: i}
+			fields := validateElectrician(*e)
+
+			if e.Phone == "" {
+				fields["phone"] = "required"
+			}
+
+			switch {
+			case len(fields) > 0:
+				fieldsJSON, _ := json.Marshal(fields)
+				results[i].Status = "error"
+				results[i].Message = string(fieldsJSON)
+			case seen[e.Phone]:
+				results[i].Status = "error"
+				results[i].Message = "Duplicate phone in import"
+			default:
+				seen[e.Phone] = true
+				phones = append(phones, e.Phone)
+			}
+		}
+
+		c := session.DB(os.Getenv("DB_NAME")).C(collection)
+
+		var existing []electrician
+
+		query := notDeleted()
+		query["phone"] = bson.M{"$in": phones}
+		err = c.Find(query).Select(bson.M{"phone": 1}).All(&existing)
+
+		if err != nil {
+			errorWithJSON(w, "Database error", http.StatusInternalServerError)
+			log.Println("Failed find existing electricians: ", err)
+			return
+		}
+
+		exists := make(map[string]bool)
+
+		for _, e := range existing {
+			exists[e.Phone] = true
+		}
+
+		bulk := c.Bulk()
+		bulk.Unordered()
+
+		var operations []int
+		userID := token.GetContext(r).ID
+		now := time.Now()
+
+		for i, e := range electricians {
+			if results[i].Status == "error" {
+				continue
+			}
+
+			selector := notDeleted()
+			selector["phone"] = e.Phone
+			bulk.Upsert(selector, importUpdate(e, userID, now))
+			operations = append(operations, i)
+
+			if exists[e.Phone] {
+				results[i].Status = "updated"
+			} else {
+				results[i].Status = "created"
+			}
+		}
+
+		if len(operations) > 0 {
+			_, err = bulk.Run()
+		}
+
+		if bulkErr, ok := err.(*mgo.BulkError); ok {
+			for _, failed := range bulkErr.Cases() {
+				if failed.Index >= 0 && failed.Index < len(operations) {
+					i := operations[failed.Index]
+					results[i].Status = "error"
+					results[i].Message = failed.Err.Error()
+				}
+			}
+		} else if err != nil {
+			errorWithJSON(w, "Database error", http.StatusInternalServerError)
+			log.Println("Failed import electricians: ", err)
+			return
+		}
+
+		jsonData, err := json.Marshal(results)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		responseWithJSON(w, jsonData, http.StatusOK)
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+
+	"gopkg.in/mgo.v2"
+)
+
+const (
+	indexConflictLog      string = "log"
+	indexConflictRecreate string = "recreate"
+	indexConflictFail     string = "fail"
+)
+
+// indexConflictMode decides what syncIndexes does when an index can't be
+// created because an incompatible one exists, e.g. a text index over other
+// fields: log and keep the old index, drop and recreate it, or fail.
+var indexConflictMode = indexConflictLog
+
+// indexConfig describes the collection's indexes. The geo index on location
+// is always created since proximity search depends on it.
+type indexConfig struct {
+	TextFields []string   `json:"textFields"`
+	Indexes    [][]string `json:"indexes"`
+}
+
+var indexes = indexConfig{
+	TextFields: []string{"name", "addressLine1", "addressLine2", "city", "county"},
+	Indexes: [][]string{
+		{"name"},
+		{"city"},
+		{"addressLine1"},
+		{"addressLine2"},
+		{"cityLower"},
+		{"countyLower"},
+		{"addressLine1Lower"},
+		{"addressLine2Lower"},
+		{"phone"},
+		{"phones.number"},
+		{"updatedAt", "_id"},
+	},
+}
+
+// initIndexConfig replaces the default indexes with those in the JSON file at
+// INDEX_CONFIG_FILE. Keys use mgo's syntax, e.g. "-createdAt" for descending.
+func initIndexConfig() {
+	path := os.Getenv("INDEX_CONFIG_FILE")
+
+	if path == "" {
+		return
+	}
+
+	data, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		panic(err)
+	}
+
+	var config indexConfig
+
+	err = json.Unmarshal(data, &config)
+
+	if err != nil {
+		panic(err)
+	}
+
+	indexes = config
+}
+
+func initIndexConflictMode() {
+	value := os.Getenv("INDEX_CONFLICT_MODE")
+
+	if value == "" {
+		return
+	}
+
+	if value != indexConflictLog && value != indexConflictRecreate && value != indexConflictFail {
+		panic("INDEX_CONFLICT_MODE must be log, recreate or fail")
+	}
+
+	indexConflictMode = value
+}
+
+// isIndexConflict reports whether err means an index with the same key or a
+// second text index already exists with different options or name.
+func isIndexConflict(err error) bool {
+	code := 0
+
+	switch err := err.(type) {
+	case *mgo.QueryError:
+		code = err.Code
+	case *mgo.LastError:
+		code = err.Code
+	}
+
+	return code == 85 || code == 86 || strings.Contains(err.Error(), "already exists with different options") || strings.Contains(err.Error(), "only one text index")
+}
+
+// conflictingIndexes returns the names of existing indexes that block
+// creating index: those with the same key, and any text index when index is
+// a text index since a collection can only have one.
+func conflictingIndexes(c *mgo.Collection, index mgo.Index) ([]string, error) {
+	existing, err := c.Indexes()
+
+	if err != nil {
+		return nil, err
+	}
+
+	name := indexName(index.Key)
+	text := strings.HasPrefix(index.Key[0], "$text:")
+	var names []string
+
+	for _, other := range existing {
+		if other.Name == "_id_" || other.Name == name {
+			continue
+		}
+
+		if indexName(other.Key) == name || (text && strings.Contains(other.Name, "_text")) {
+			names = append(names, other.Name)
+		}
+	}
+
+	return names, nil
+}
+
+// createIndex creates index, resolving a conflict with an existing index
+// according to indexConflictMode.
+func createIndex(c *mgo.Collection, index mgo.Index) error {
+	err := c.EnsureIndex(index)
+
+	if err == nil || !isIndexConflict(err) || indexConflictMode == indexConflictFail {
+		return err
+	}
+
+	if indexConflictMode == indexConflictLog {
+		log.Println("Warning: keeping conflicting index, set INDEX_CONFLICT_MODE=recreate to replace it: ", err)
+		return nil
+	}
+
+	names, err := conflictingIndexes(c, index)
+
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		log.Println("Dropping conflicting index: ", name)
+		err = c.DropIndexName(name)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return c.EnsureIndex(index)
+}
+
+// indexName returns the name mgo gives an index created without one.
+func indexName(key []string) string {
+	parts := make([]string, 0, len(key))
+
+	for _, field := range key {
+		switch {
+		case strings.HasPrefix(field, "$"):
+			kind := strings.SplitN(field[1:], ":", 2)
+			parts = append(parts, kind[1]+"_"+kind[0])
+		case strings.HasPrefix(field, "-"):
+			parts = append(parts, field[1:]+"_-1")
+		default:
+			parts = append(parts, strings.TrimPrefix(field, "+")+"_1")
+		}
+	}
+
+	return strings.Join(parts, "_")
+}
+
+// syncIndexes creates configured indexes that are missing and logs existing
+// ones that are no longer configured. Those are left for /admin/reindex to
+// drop, so a config mistake can't silently remove an index.
+func syncIndexes(c *mgo.Collection) error {
+	existing, err := indexNames(c)
+
+	if err != nil {
+		return err
+	}
+
+	exists := make(map[string]bool)
+
+	for _, name := range existing {
+		exists[name] = true
+	}
+
+	wanted := map[string]bool{"_id_": true}
+
+	for _, index := range electricianIndexes() {
+		name := indexName(index.Key)
+		wanted[name] = true
+
+		if exists[name] {
+			continue
+		}
+
+		log.Println("Creating index: ", name)
+		err = createIndex(c, index)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	// Reload the names since conflicting indexes may have been dropped.
+	existing, err = indexNames(c)
+
+	if err != nil {
+		return err
+	}
+
+	for _, name := range existing {
+		if !wanted[name] {
+			log.Println("Warning: index is not in the index config: ", name)
+		}
+	}
+
+	return nil
+}
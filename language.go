@@ -0,0 +1,54 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// textLanguages maps accepted language codes and names to MongoDB text search
+// languages. The text index uses each record's language field as its language
+// override, which is MongoDB's default override field name.
+var textLanguages = map[string]string{
+	"nb":        "norwegian",
+	"nn":        "norwegian",
+	"no":        "norwegian",
+	"norwegian": "norwegian",
+	"en":        "english",
+	"english":   "english",
+	"none":      "none",
+}
+
+func textLanguage(value string) (string, bool) {
+	language, ok := textLanguages[strings.ToLower(strings.TrimSpace(value))]
+	return language, ok
+}
+
+// acceptedLanguage returns the Accept-Language entry with the highest quality
+// whose primary tag is a supported text language, or "" when there is none.
+func acceptedLanguage(header string) string {
+	best, bestQuality := "", 0.0
+
+	for _, entry := range strings.Split(header, ",") {
+		parts := strings.Split(entry, ";")
+		tag := strings.SplitN(strings.TrimSpace(parts[0]), "-", 2)[0]
+		quality := 1.0
+
+		for _, param := range parts[1:] {
+			param = strings.TrimSpace(param)
+
+			if strings.HasPrefix(param, "q=") {
+				q, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64)
+
+				if err == nil {
+					quality = q
+				}
+			}
+		}
+
+		if _, ok := textLanguage(tag); ok && tag != "none" && quality > bestQuality {
+			best, bestQuality = tag, quality
+		}
+	}
+
+	return best
+}
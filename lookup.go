@@ -0,0 +1,75 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// lookupOne responds with the first active record matching query. More than
+// one match means duplicates that should be merged, so it is logged.
+func lookupOne(w http.ResponseWriter, r *http.Request, session *mgo.Session, query bson.M) {
+	c := session.DB(os.Getenv("DB_NAME")).C(collection)
+
+	for key, value := range notDeleted() {
+		query[key] = value
+	}
+
+	var electricians []electrician
+	err := c.Find(query).Sort("_id").Limit(2).All(&electricians)
+
+	if err != nil {
+		errorWithJSON(w, "Database error", http.StatusInternalServerError)
+		log.Println("Failed look up electrician: ", err)
+		return
+	}
+
+	if len(electricians) == 0 {
+		errorWithJSON(w, "Electrician not found", http.StatusNotFound)
+		return
+	}
+
+	if len(electricians) > 1 {
+		log.Printf("Warning: %v matches more than one electrician, returning %v", r.URL.Path, electricians[0].ID.Hex())
+	}
+
+	electrician := electricians[0]
+	computeCompleteness(&electrician)
+	prepareElectrician(r, &electrician)
+
+	jsonData, err := marshalFields(electrician, responseFields(r))
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	responseWithJSON(w, jsonData, http.StatusOK)
+}
+
+func getByPhone(s *mgo.Session) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session := readSession(s)
+		defer session.Close()
+
+		vars := mux.Vars(r)
+		phone := strings.TrimPrefix(normalizePhone(vars["phone"]), "+")
+
+		if phone == "" {
+			errorWithJSON(w, "Invalid phone", http.StatusBadRequest)
+			return
+		}
+
+		// Stored numbers may or may not have a leading +, so match both forms like
+		// the search phone filter does.
+		numbers := []string{phone, "+" + phone}
+		lookupOne(w, r, session, bson.M{"$or": []bson.M{
+			{"phone": bson.M{"$in": numbers}},
+			{"phones.number": bson.M{"$in": numbers}},
+		}})
+	}
+}
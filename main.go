@@ -1,13 +1,15 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
+	"net/mail"
+	"net/url"
 	"os"
 
-	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/stianba/auth-service/token"
@@ -16,32 +18,85 @@ import (
 )
 
 const collection string = "electricians"
+const adminPermissionLevel float64 = 2
+
+var basePath string
 
 type electrician struct {
-	ID           bson.ObjectId `json:"_id" bson:"_id,omitempty"`
-	Name         string        `json:"name"`
-	AddressLine1 string        `json:"addressLine1" bson:"addressLine1"`
-	AddressLine2 string        `json:"addressLine2" bson:"addressLine2"`
-	City         string        `json:"city"`
-	County       string        `json:"county"`
-	Zip          string        `json:"zip"`
-	Phone        string        `json:"phone"`
-	Location     geo           `json:"location"`
+	ID            bson.ObjectId `json:"_id" bson:"_id,omitempty"`
+	Name          string        `json:"name"`
+	AddressLine1  string        `json:"addressLine1" bson:"addressLine1"`
+	AddressLine2  string        `json:"addressLine2,omitempty" bson:"addressLine2"`
+	City          string        `json:"city"`
+	County        string        `json:"county,omitempty"`
+	Zip           string        `json:"zip,omitempty"`
+	Phone         string        `json:"phone"`
+	Phones        []phoneNumber `json:"phones,omitempty" bson:"phones,omitempty"`
+	Website       string        `json:"website,omitempty"`
+	Email         string        `json:"email,omitempty" bson:"email,omitempty"`
+	OrgNumber     string        `json:"orgNumber,omitempty" bson:"orgNumber,omitempty"`
+	Location      geo           `json:"location"`
+	GeocodeSource string        `json:"geocodeSource,omitempty" bson:"geocodeSource,omitempty"`
+	Tags          []string      `json:"tags,omitempty"`
+	Language      string        `json:"language,omitempty"`
+	Rating        *float64      `json:"rating,omitempty" bson:"rating,omitempty"`
+	CreatedAt     time.Time     `json:"createdAt" bson:"createdAt"`
+	UpdatedAt     time.Time     `json:"updatedAt" bson:"updatedAt"`
+	CreatedBy     string        `json:"createdBy,omitempty" bson:"createdBy"`
+	UpdatedBy     string        `json:"updatedBy,omitempty" bson:"updatedBy"`
+	Version       int           `json:"version" bson:"version"`
+	InternalNotes string        `json:"internalNotes,omitempty" bson:"internalNotes,omitempty"`
+	Completeness  *float64      `json:"completeness,omitempty" bson:"completeness,omitempty"`
+	Score         *float64      `json:"score,omitempty" bson:"-"`
+	DeletedAt     *time.Time    `json:"deletedAt,omitempty" bson:"deletedAt,omitempty"`
+
+	// Lower-cased copies for prefix search, see prefixFields.
+	CityLower         string `json:"-" bson:"cityLower,omitempty"`
+	CountyLower       string `json:"-" bson:"countyLower,omitempty"`
+	AddressLine1Lower string `json:"-" bson:"addressLine1Lower,omitempty"`
+	AddressLine2Lower string `json:"-" bson:"addressLine2Lower,omitempty"`
 }
 
 type geo struct {
 	Type        string    `json:"-"`
 	Coordinates []float64 `json:"coordinates"`
+	latLng      bool
+}
+
+func electricianIndexes() []mgo.Index {
+	geoIndex := mgo.Index{
+		Key: []string{"$2dsphere:location"},
+	}
+
+	result := []mgo.Index{geoIndex, orgNumberIndex()}
+
+	if len(indexes.TextFields) > 0 {
+		textSearchIndex := mgo.Index{}
+
+		for _, field := range indexes.TextFields {
+			textSearchIndex.Key = append(textSearchIndex.Key, "$text:"+field)
+		}
+
+		result = append(result, textSearchIndex)
+	}
+
+	for _, key := range indexes.Indexes {
+		result = append(result, mgo.Index{Key: key})
+	}
+
+	return result
 }
 
-type searchParams struct {
-	Skip          int
-	Limit         int
-	Text          string
-	Hint          string
-	Lon           float64
-	Lat           float64
-	LocationScope int
+func createIndexes(c *mgo.Collection) error {
+	for _, index := range electricianIndexes() {
+		err := c.EnsureIndex(index)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 func ensureIndex(s *mgo.Session) {
@@ -49,36 +104,83 @@ func ensureIndex(s *mgo.Session) {
 	defer session.Close()
 
 	c := session.DB(os.Getenv("DB_NAME")).C(collection)
+	err := syncIndexes(c)
 
-	geoIndex := mgo.Index{
-		Key: []string{"$2dsphere:location"},
+	if err != nil {
+		panic(err)
 	}
+}
+
+func notDeleted() bson.M {
+	return bson.M{"deletedAt": bson.M{"$exists": false}}
+}
 
-	err := c.EnsureIndex(geoIndex)
+func activeID(id bson.ObjectId) bson.M {
+	query := notDeleted()
+	query["_id"] = id
+	return query
+}
 
-	if err != nil {
-		panic(err)
+// softDelete marks a record deleted and bumps updatedAt so it shows up in
+// /changes. It returns the record as it was deleted.
+// versionedID matches e only while it is still at the version it was read
+// with. Records created before versioning have no version field.
+func versionedID(e electrician) bson.M {
+	selector := activeID(e.ID)
+	selector["version"] = e.Version
+
+	if e.Version == 0 {
+		selector["version"] = bson.M{"$in": []interface{}{0, nil}}
 	}
 
-	textSearchIndex := mgo.Index{
-		Key: []string{"$text:name", "$text:addressLine1", "$text:addressLine2", "$text:city", "$text:county"},
+	return selector
+}
+
+func softDelete(c *mgo.Collection, id bson.ObjectId) (deleted electrician, err error) {
+	now := time.Now()
+	change := mgo.Change{
+		Update:    bson.M{"$set": bson.M{"deletedAt": now, "updatedAt": now}},
+		ReturnNew: true,
 	}
 
-	err = c.EnsureIndex(textSearchIndex)
+	_, err = c.Find(activeID(id)).Apply(change, &deleted)
+	return
+}
 
-	if err != nil {
-		panic(err)
+// requestSession copies s for a handler, with HANDLER_TIMEOUT as the socket
+// timeout so its queries give up along with the request. Streaming and
+// long-running admin handlers copy s directly and keep the default.
+func requestSession(s *mgo.Session) *mgo.Session {
+	session := s.Copy()
+
+	if handlerTimeout > 0 {
+		session.SetSocketTimeout(handlerTimeout)
 	}
 
-	hintIndex := mgo.Index{
-		Key: []string{"name"},
+	return session
+}
+
+// streamSession copies s for a read handler, from a secondary when
+// READ_FROM_SECONDARY is true.
+func streamSession(s *mgo.Session) *mgo.Session {
+	session := s.Copy()
+
+	if os.Getenv("READ_FROM_SECONDARY") == "true" {
+		session.SetMode(mgo.SecondaryPreferred, false)
 	}
 
-	err = c.EnsureIndex(hintIndex)
+	return session
+}
 
-	if err != nil {
-		panic(err)
+// readSession is streamSession with the HANDLER_TIMEOUT socket timeout.
+func readSession(s *mgo.Session) *mgo.Session {
+	session := streamSession(s)
+
+	if handlerTimeout > 0 {
+		session.SetSocketTimeout(handlerTimeout)
 	}
+
+	return session
 }
 
 func errorWithJSON(w http.ResponseWriter, err string, code int) {
@@ -93,206 +195,320 @@ func responseWithJSON(w http.ResponseWriter, json []byte, code int) {
 	w.Write(json)
 }
 
+func validWebsite(website string) bool {
+	u, err := url.Parse(website)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func validEmail(email string) bool {
+	address, err := mail.ParseAddress(email)
+	return err == nil && address.Address == email
+}
+
+func prefersMinimal(r *http.Request) bool {
+	for _, header := range r.Header["Prefer"] {
+		for _, preference := range strings.Split(header, ",") {
+			if strings.TrimSpace(preference) == "return=minimal" {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
 func isAuthenticated(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authHeader, ok := r.Header["Authorization"]
 
 		if ok {
-			persistentData, err := token.FromHeader(authHeader)
+			persistentData, err := userFromHeader(authHeader)
 
 			if err != nil {
 				errorWithJSON(w, err.Error(), http.StatusBadRequest)
 				return
 			}
 
-			ctx := token.ToContext(persistentData, r)
-			next.ServeHTTP(w, r.WithContext(ctx))
+			next.ServeHTTP(w, withUser(r, persistentData))
 		} else {
 			errorWithJSON(w, "No auth header found", http.StatusBadRequest)
 		}
 	})
 }
 
-func listAll(s *mgo.Session) func(w http.ResponseWriter, r *http.Request) {
+func isAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token.GetContext(r).PermissionLevel < adminPermissionLevel {
+			errorWithJSON(w, "Insufficient permissions", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func health(s *mgo.Session) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
-		session := s.Copy()
+		session := requestSession(s)
 		defer session.Close()
 
-		var electricians []electrician
-
-		c := session.DB(os.Getenv("DB_NAME")).C(collection)
-		err := c.Find(bson.M{}).Sort("name").Limit(10).All(&electricians)
+		err := session.Ping()
 
 		if err != nil {
-			errorWithJSON(w, "Database error", http.StatusInternalServerError)
-			log.Println("Failed get all electricians: ", err)
+			errorWithJSON(w, "Database unreachable", http.StatusServiceUnavailable)
+			log.Println("Failed ping database: ", err)
 			return
 		}
 
-		jsonData, err := json.Marshal(electricians)
-
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		responseWithJSON(w, jsonData, http.StatusOK)
+		responseWithJSON(w, []byte("{\"status\":\"ok\"}"), http.StatusOK)
 	}
 }
 
-func search(s *mgo.Session) func(w http.ResponseWriter, r *http.Request) {
+func listAll(s *mgo.Session) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
-		session := s.Copy()
+		session := readSession(s)
 		defer session.Close()
 
 		var electricians []electrician
 
-		pipes := make([]bson.M, 0)
-		params := searchParams{Skip: 0, Limit: 10, LocationScope: 3000}
-		queries := r.URL.Query()
+		c := session.DB(os.Getenv("DB_NAME")).C(collection)
+		query := notDeleted()
 
-		skipQuery, ok := queries["skip"]
+		if r.URL.Query().Get("includeDeleted") == "true" {
+			if permissionLevel(r) < adminPermissionLevel {
+				errorWithJSON(w, "Insufficient permissions", http.StatusForbidden)
+				return
+			}
 
-		if ok {
-			if len(skipQuery) > 0 {
-				i, err := strconv.ParseInt(skipQuery[0], 10, 64)
+			query = bson.M{}
+		}
 
-				if err != nil {
-					panic(err)
-				}
+		if r.URL.Query().Get("countOnly") == "true" {
+			started := time.Now()
+			count, err := c.Find(query).Count()
+			logSlowQuery("listAll count", query, started)
 
-				params.Skip = int(i)
+			if err != nil {
+				errorWithJSON(w, "Database error", http.StatusInternalServerError)
+				log.Println("Failed count electricians: ", err)
+				return
 			}
-		}
 
-		limitQuery, ok := queries["limit"]
+			responseWithJSON(w, []byte(fmt.Sprintf("{\"count\":%d}", count)), http.StatusOK)
+			return
+		}
 
-		if ok {
-			if len(limitQuery) > 0 {
-				i, err := strconv.ParseInt(limitQuery[0], 10, 64)
+		started := time.Now()
+		err := c.Find(query).Sort("name", "_id").Limit(10).All(&electricians)
+		logSlowQuery("listAll", query, started)
 
-				if err != nil {
-					panic(err)
-				}
-
-				params.Limit = int(i)
-			}
+		if err != nil {
+			errorWithJSON(w, "Database error", http.StatusInternalServerError)
+			log.Println("Failed get all electricians: ", err)
+			return
 		}
 
-		textQuery, ok := queries["text"]
-
-		if ok {
-			if len(textQuery) > 0 {
-				params.Text = textQuery[0]
-			}
+		if clientGone(r) {
+			return
 		}
 
-		hintQuery, ok := queries["hint"]
+		prepareElectricians(r, electricians)
+		jsonData, err := marshalFields(electricians, responseFields(r))
 
-		if ok {
-			if len(hintQuery) > 0 {
-				params.Hint = hintQuery[0]
-			}
+		if err != nil {
+			log.Fatal(err)
 		}
 
-		lonQuery, ok := queries["lon"]
+		responseWithJSON(w, jsonData, http.StatusOK)
+	}
+}
 
-		if ok {
-			if len(lonQuery) > 0 {
-				params.Lon, _ = strconv.ParseFloat(lonQuery[0], 64)
-			}
-		}
+func getOne(s *mgo.Session) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session := readSession(s)
+		defer session.Close()
 
-		latQuery, ok := queries["lat"]
+		vars := mux.Vars(r)
+		id := vars["id"]
 
-		if ok {
-			if len(latQuery) > 0 {
-				params.Lat, _ = strconv.ParseFloat(latQuery[0], 64)
-			}
+		if !bson.IsObjectIdHex(id) {
+			errorWithJSON(w, "Invalid id", http.StatusBadRequest)
+			return
 		}
 
-		if params.Text != "" {
-			pipe := bson.M{"$match": bson.M{"$text": bson.M{"$search": params.Text}}}
-			sort := bson.M{"$sort": bson.M{"name": 1}}
-			pipes = append(pipes, pipe, sort)
-		}
+		var electrician electrician
 
-		if params.Hint != "" {
-			pipe := bson.M{"$match": bson.M{"name": bson.M{"$regex": bson.RegEx{Pattern: "^" + params.Hint, Options: "i"}}}}
-			sort := bson.M{"$sort": bson.M{"name": 1}}
-			pipes = append(pipes, pipe, sort)
-		}
+		c := session.DB(os.Getenv("DB_NAME")).C(collection)
+		started := time.Now()
+		err := c.Find(activeID(bson.ObjectIdHex(id))).One(&electrician)
+		logSlowQuery("getOne", activeID(bson.ObjectIdHex(id)), started)
 
-		if params.Lon > 0 {
-			pipe := bson.M{
-				"$geoNear": bson.M{
-					"near":          []float64{params.Lon, params.Lat},
-					"distanceField": "distance",
-					"maxDistance":   params.LocationScope,
-					"spherical":     true,
-				},
+		if err != nil {
+			switch err {
+			default:
+				errorWithJSON(w, "Database error", http.StatusInternalServerError)
+				log.Println("Failed get electrician: ", err)
+				return
+			case mgo.ErrNotFound:
+				errorWithJSON(w, "Electrician not found", http.StatusNotFound)
+				return
 			}
-
-			sort := bson.M{"$sort": bson.M{"distance": 1}}
-			pipes = append(pipes, pipe, sort)
 		}
 
-		skip := bson.M{"$skip": params.Skip}
-		limit := bson.M{"$limit": params.Limit}
-		pipes = append(pipes, skip, limit)
+		computeCompleteness(&electrician)
+		prepareElectrician(r, &electrician)
 
-		c := session.DB(os.Getenv("DB_NAME")).C(collection)
-		c.Pipe(pipes).All(&electricians)
-		electriciansJSON, err := json.Marshal(electricians)
+		jsonData, err := marshalFields(electrician, responseFields(r))
 
 		if err != nil {
 			log.Fatal(err)
 		}
 
-		responseWithJSON(w, electriciansJSON, http.StatusOK)
+		responseWithJSON(w, jsonData, http.StatusOK)
 	}
 }
 
 func create(s *mgo.Session) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
-		session := s.Copy()
+		session := requestSession(s)
 		defer session.Close()
 
+		if err := requestWriteConcern(session, r); err != nil {
+			errorWithJSON(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		idempotencyKey := r.Header.Get("Idempotency-Key")
+
+		// Keys are per user, so one caller can't replay another's response.
+		if idempotencyKey != "" {
+			idempotencyKey = token.GetContext(r).ID + ":" + idempotencyKey
+
+			previous, reserved, err := reserveIdempotencyKey(session, idempotencyKey)
+
+			if err != nil {
+				errorWithJSON(w, "Database error", http.StatusInternalServerError)
+				log.Println("Failed reserve idempotency key: ", err)
+				return
+			}
+
+			if !reserved {
+				if previous.Status == 0 {
+					errorWithJSON(w, "A request with this Idempotency-Key is in progress", http.StatusConflict)
+					return
+				}
+
+				responseWithJSON(w, previous.Body, previous.Status)
+				return
+			}
+		}
+
+		created := false
+
+		defer func() {
+			if idempotencyKey != "" && !created {
+				releaseIdempotencyKey(session, idempotencyKey)
+			}
+		}()
+
 		electrician := electrician{ID: bson.NewObjectId()}
 
-		decoder := json.NewDecoder(r.Body)
-		err := decoder.Decode(&electrician)
+		err := decodeBody(r, &electrician)
 
 		electrician.Location.Type = "Point"
+		electrician.GeocodeSource = ""
+
+		if len(electrician.Location.Coordinates) > 0 {
+			electrician.GeocodeSource = geocodeSourceUser
+		}
+
+		if coordinateErr, ok := err.(*coordinateError); ok {
+			validationErrorWithJSON(w, map[string]string{"location": coordinateErr.Error()})
+			return
+		}
 
 		if err != nil {
 			errorWithJSON(w, "Icorrect body", http.StatusBadRequest)
 			return
 		}
 
+		stripRestrictedOne(r, &electrician)
+		syncPhones(&electrician)
+		syncPrefixFields(&electrician)
+		electrician.OrgNumber = normalizeOrgNumber(electrician.OrgNumber)
+
+		if language, ok := textLanguage(electrician.Language); ok {
+			electrician.Language = language
+		}
+
+		if fields := validateElectrician(electrician); len(fields) > 0 {
+			validationErrorWithJSON(w, fields)
+			return
+		}
+
+		electrician.Completeness = nil
+		electrician.DeletedAt = nil
+		electrician.CreatedAt = time.Now()
+		electrician.UpdatedAt = electrician.CreatedAt
+		electrician.Version = 1
+		electrician.CreatedBy = token.GetContext(r).ID
+		electrician.UpdatedBy = electrician.CreatedBy
+
 		c := session.DB(os.Getenv("DB_NAME")).C(collection)
 		err = c.Insert(electrician)
 
+		if mgo.IsDup(err) {
+			errorWithJSON(w, "An electrician with this orgNumber already exists", http.StatusConflict)
+			return
+		}
+
 		if err != nil {
 			errorWithJSON(w, "Database error", http.StatusInternalServerError)
 			log.Println("Failed insert electrician: ", err)
 			return
 		}
 
-		electricianJSON, _ := json.Marshal(electrician)
+		created = true
+		notifyWebhooks(webhookEvent{Type: "created", ID: electrician.ID.Hex(), Electrician: &electrician})
+
+		prepareElectrician(r, &electrician)
+		electricianJSON, err := marshalFields(electrician, parseFields(r.URL.Query().Get("fields")))
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if idempotencyKey != "" {
+			saveIdempotentResponse(session, idempotencyKey, http.StatusCreated, electricianJSON)
+		}
+
+		w.Header().Set("Location", basePath+"/"+electrician.ID.Hex())
+
+		if prefersMinimal(r) {
+			w.Header().Set("Preference-Applied", "return=minimal")
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+
 		responseWithJSON(w, electricianJSON, http.StatusCreated)
 	}
 }
 
-func delete(s *mgo.Session) func(w http.ResponseWriter, r *http.Request) {
+func remove(s *mgo.Session) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
-		session := s.Copy()
-		defer session.Close()
-
 		vars := mux.Vars(r)
 		id := vars["id"]
 
+		if !bson.IsObjectIdHex(id) {
+			errorWithJSON(w, "Invalid id", http.StatusBadRequest)
+			return
+		}
+
+		session := requestSession(s)
+		defer session.Close()
+
 		c := session.DB(os.Getenv("DB_NAME")).C(collection)
-		err := c.RemoveId(bson.ObjectIdHex(id))
+		deleted, err := softDelete(c, bson.ObjectIdHex(id))
 
 		if err != nil {
 			switch err {
@@ -305,12 +521,27 @@ func delete(s *mgo.Session) func(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 
-		responseWithJSON(w, []byte(fmt.Sprint("{\"message\":\"electrician_deleted\"}")), http.StatusOK)
+		notifyWebhooks(webhookEvent{Type: "deleted", ID: id, Electrician: &deleted})
+
+		prepareElectrician(r, &deleted)
+		jsonData, err := marshalFields(deleted, responseFields(r))
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		responseWithJSON(w, jsonData, http.StatusOK)
 	}
 }
 
 func main() {
-	session, err := mgo.Dial(fmt.Sprintf("mongodb://%v:%v@%v/%v", os.Getenv("DB_USER"), os.Getenv("DB_PASSWORD"), os.Getenv("DB_HOST"), os.Getenv("DB_NAME")))
+	uri := os.Getenv("DB_URI")
+
+	if uri == "" {
+		uri = fmt.Sprintf("mongodb://%v:%v@%v/%v", os.Getenv("DB_USER"), os.Getenv("DB_PASSWORD"), os.Getenv("DB_HOST"), os.Getenv("DB_NAME"))
+	}
+
+	session, err := dial(uri)
 
 	if err != nil {
 		panic(err)
@@ -318,8 +549,34 @@ func main() {
 
 	defer session.Close()
 	session.SetMode(mgo.Monotonic, true)
+	initHandlerTimeout()
+	initWriteConcern(session)
+	initIndexConfig()
+	initIndexConflictMode()
 	ensureIndex(session)
-
+	ensureIdempotencyIndex(session)
+	backfillPrefixFields(session)
+	initReadOnly()
+	initSlowQueryLog()
+	initResultWindow()
+	initDisabledEndpoints()
+	initCache()
+	initTrustedProxies()
+	initRegions()
+	syncRegionCollection(session)
+	initOrgNumberFormat()
+	initAllowedTags()
+	initArrayLimits()
+	initConcurrencyLimit()
+	initEventSubscribers()
+	initRateLimit()
+	initCORS()
+	initPublicFields()
+	initSearchEnvelope()
+	initDefaultBBox()
+	seedCollection(session)
+
+	basePath = strings.TrimSuffix(os.Getenv("BASE_PATH"), "/")
 	port := os.Getenv("PORT")
 
 	if port == "" {
@@ -327,9 +584,78 @@ func main() {
 	}
 
 	router := mux.NewRouter()
-	router.HandleFunc("/", listAll(session)).Methods("GET")
-	router.HandleFunc("/search", search(session)).Methods("GET")
-	router.Handle("/", isAuthenticated(http.HandlerFunc(create(session)))).Methods("POST")
-	router.Handle("/{id}", isAuthenticated(http.HandlerFunc(delete(session)))).Methods("DELETE")
-	http.ListenAndServe(":"+port, router)
+	api := router
+
+	if basePath != "" {
+		api = router.PathPrefix(basePath).Subrouter()
+	}
+
+	if os.Getenv("HEALTH_AT_ROOT") == "true" {
+		router.HandleFunc("/health", health(session)).Methods("GET")
+		router.HandleFunc("/health/detail", healthDetail(session)).Methods("GET")
+	} else {
+		api.HandleFunc("/health", health(session)).Methods("GET")
+		api.HandleFunc("/health/detail", healthDetail(session)).Methods("GET")
+	}
+
+	api.Handle("/", optionalAuth(http.HandlerFunc(listAll(session)))).Name("list").Methods("GET")
+	api.Handle("/search", optionalAuth(http.HandlerFunc(search(session)))).Name("search").Methods("GET")
+	api.Handle("/search", optionalAuth(http.HandlerFunc(searchWithBody(session)))).Name("search").Methods("POST")
+	api.Handle("/clusters", optionalAuth(http.HandlerFunc(clusters(session)))).Name("clusters").Methods("GET")
+	api.Handle("/changes", optionalAuth(http.HandlerFunc(changes(session)))).Name("changes").Methods("GET")
+	api.Handle("/events", optionalAuth(http.HandlerFunc(streamEvents(session)))).Name("events").Methods("GET")
+	streamingPaths[basePath+"/events"] = true
+	api.HandleFunc("/cities", distinctValues(session, "city")).Name("cities").Methods("GET")
+	api.HandleFunc("/cities/suggest", suggestCities(session)).Name("suggestCities").Methods("GET")
+	api.HandleFunc("/counties", distinctValues(session, "county")).Name("counties").Methods("GET")
+	api.HandleFunc("/distance-bands", distanceBands(session)).Name("distanceBands").Methods("GET")
+	api.HandleFunc("/reverse-region", reverseRegion(session)).Name("reverseRegion").Methods("GET")
+	api.HandleFunc("/auth/verify", verifyToken).Name("verify").Methods("GET")
+	api.Handle("/", isAuthenticated(writable(http.HandlerFunc(create(session))))).Name("create").Methods("POST")
+	api.Handle("/{id}", isAuthenticated(writable(http.HandlerFunc(remove(session))))).Name("delete").Methods("DELETE")
+	api.Handle("/{id}", isAuthenticated(writable(http.HandlerFunc(patchElectrician(session))))).Name("patch").Methods("PATCH")
+	api.Handle("/{id}/touch", isAuthenticated(writable(http.HandlerFunc(touch(session))))).Name("touch").Methods("POST")
+	api.Handle("/duplicates", isAuthenticated(isAdmin(http.HandlerFunc(duplicates(session))))).Name("duplicates").Methods("GET")
+	api.Handle("/import", isAuthenticated(isAdmin(writable(http.HandlerFunc(importElectricians(session)))))).Name("import").Methods("POST")
+	longRunningPaths[basePath+"/import"] = true
+	api.Handle("/merge", isAuthenticated(isAdmin(writable(http.HandlerFunc(merge(session)))))).Name("merge").Methods("POST")
+	longRunningPaths[basePath+"/merge"] = true
+	api.Handle("/admin/reindex", isAuthenticated(isAdmin(http.HandlerFunc(reindex(session))))).Name("reindex").Methods("POST")
+	longRunningPaths[basePath+"/admin/reindex"] = true
+	api.Handle("/admin/geocode-missing", isAuthenticated(isAdmin(writable(http.HandlerFunc(geocodeMissing(session)))))).Name("geocode").Methods("POST")
+	longRunningPaths[basePath+"/admin/geocode-missing"] = true
+	api.Handle("/admin/coordinates", isAuthenticated(isAdmin(writable(http.HandlerFunc(updateCoordinates(session)))))).Name("coordinates").Methods("POST")
+	api.Handle("/admin/tag", isAuthenticated(isAdmin(writable(http.HandlerFunc(tagElectricians(session)))))).Name("tag").Methods("POST")
+	api.Handle("/admin/dump", isAuthenticated(isAdmin(http.HandlerFunc(dump(session))))).Name("dump").Methods("GET")
+	streamingPaths[basePath+"/admin/dump"] = true
+	api.Handle("/admin/restore", isAuthenticated(isAdmin(writable(http.HandlerFunc(restore(session)))))).Name("restore").Methods("POST")
+	streamingPaths[basePath+"/admin/restore"] = true
+	api.Handle("/admin/validate", isAuthenticated(isAdmin(http.HandlerFunc(auditRecords(session))))).Name("validate").Methods("GET")
+	api.Handle("/admin/cache", isAuthenticated(isAdmin(http.HandlerFunc(showCacheStats)))).Name("cacheStats").Methods("GET")
+	api.Handle("/admin/read-only", isAuthenticated(isAdmin(http.HandlerFunc(toggleReadOnly)))).Name("readOnly").Methods("POST")
+	api.Handle("/by-org/{orgNumber}", optionalAuth(http.HandlerFunc(getByOrgNumber(session)))).Name("byOrg").Methods("GET")
+	api.Handle("/by-phone/{phone}", optionalAuth(http.HandlerFunc(getByPhone(session)))).Name("byPhone").Methods("GET")
+	api.Handle("/export.vcf", isAuthenticated(isAdmin(http.HandlerFunc(exportVCards(session))))).Name("exportVCards").Methods("GET")
+	streamingPaths[basePath+"/export.vcf"] = true
+	api.HandleFunc("/{id}.vcf", getVCard(session)).Name("vcard").Methods("GET")
+	api.Handle("/{id}", optionalAuth(http.HandlerFunc(getOne(session)))).Name("get").Methods("GET")
+	handleOptions(api)
+
+	handler := withCache(router, featureFlags(router))
+	handler = prettyJSON(checkCRS(handler))
+	handler = withRateLimit(withTimeout(limitConcurrency(handler)))
+	handler = recoverMiddleware(withCORS(router, handler))
+
+	srv := &http.Server{Addr: ":" + port, Handler: handler}
+	cert, key := os.Getenv("TLS_CERT"), os.Getenv("TLS_KEY")
+
+	if cert != "" && key != "" {
+		if redirectPort := os.Getenv("HTTP_REDIRECT_PORT"); redirectPort != "" {
+			go http.ListenAndServe(":"+redirectPort, redirectToHTTPS(port))
+		}
+
+		log.Fatal(srv.ListenAndServeTLS(cert, key))
+	}
+
+	log.Fatal(srv.ListenAndServe())
 }
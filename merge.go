@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/stianba/auth-service/token"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type mergeRequest struct {
+	Keep   string `json:"keep"`
+	Remove string `json:"remove"`
+}
+
+// fillEmptyFields copies fields populated in from into keep where keep has none.
+func fillEmptyFields(keep *electrician, from electrician) bson.M {
+	set := bson.M{}
+
+	fill := func(field string, target *string, value string) {
+		if *target == "" && value != "" {
+			*target = value
+			set[field] = value
+		}
+	}
+
+	fill("name", &keep.Name, from.Name)
+	fill("addressLine1", &keep.AddressLine1, from.AddressLine1)
+	fill("addressLine2", &keep.AddressLine2, from.AddressLine2)
+	fill("city", &keep.City, from.City)
+	fill("county", &keep.County, from.County)
+	fill("zip", &keep.Zip, from.Zip)
+	fill("phone", &keep.Phone, from.Phone)
+	fill("website", &keep.Website, from.Website)
+	fill("email", &keep.Email, from.Email)
+	fill("orgNumber", &keep.OrgNumber, from.OrgNumber)
+	fill("internalNotes", &keep.InternalNotes, from.InternalNotes)
+
+	if len(keep.Location.Coordinates) == 0 && len(from.Location.Coordinates) > 0 {
+		keep.Location = from.Location
+		keep.GeocodeSource = from.GeocodeSource
+		set["location"] = from.Location
+		set["geocodeSource"] = from.GeocodeSource
+	}
+
+	for _, phone := range from.Phones {
+		if !containsPhone(keep.Phones, phone.Number) {
+			keep.Phones = append(keep.Phones, phone)
+			set["phones"] = keep.Phones
+		}
+	}
+
+	syncPrefixFields(keep)
+	lowered := prefixValues(*keep)
+
+	for field, lower := range prefixFields {
+		if _, ok := set[field]; ok {
+			set[lower] = lowered[lower]
+		}
+	}
+
+	if keep.Rating == nil && from.Rating != nil {
+		keep.Rating = from.Rating
+		set["rating"] = *from.Rating
+	}
+
+	for _, tag := range from.Tags {
+		if !containsString(keep.Tags, tag) {
+			keep.Tags = append(keep.Tags, tag)
+			set["tags"] = keep.Tags
+		}
+	}
+
+	return set
+}
+
+func containsPhone(phones []phoneNumber, number string) bool {
+	for _, phone := range phones {
+		if phone.Number == number {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func merge(s *mgo.Session) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session := requestSession(s)
+		defer session.Close()
+
+		var req mergeRequest
+
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&req)
+
+		if err != nil || !bson.IsObjectIdHex(req.Keep) || !bson.IsObjectIdHex(req.Remove) {
+			errorWithJSON(w, "Incorrect body", http.StatusBadRequest)
+			return
+		}
+
+		if req.Keep == req.Remove {
+			errorWithJSON(w, "keep and remove must be different", http.StatusBadRequest)
+			return
+		}
+
+		c := session.DB(os.Getenv("DB_NAME")).C(collection)
+
+		var keep, remove electrician
+
+		for _, find := range []struct {
+			id     string
+			result *electrician
+		}{{req.Keep, &keep}, {req.Remove, &remove}} {
+			err = c.Find(activeID(bson.ObjectIdHex(find.id))).One(find.result)
+
+			if err != nil {
+				switch err {
+				default:
+					errorWithJSON(w, "Database error", http.StatusInternalServerError)
+					log.Println("Failed find electrician: ", err)
+					return
+				case mgo.ErrNotFound:
+					errorWithJSON(w, "Electrician not found", http.StatusNotFound)
+					return
+				}
+			}
+		}
+
+		set := fillEmptyFields(&keep, remove)
+		keep.UpdatedAt = time.Now()
+		keep.UpdatedBy = token.GetContext(r).ID
+		set["updatedAt"] = keep.UpdatedAt
+		set["updatedBy"] = keep.UpdatedBy
+
+		// The unique orgNumber index only lets keep take over remove's
+		// orgNumber once remove is deleted, so that moves last.
+		orgNumber, moveOrgNumber := set["orgNumber"]
+		delete(set, "orgNumber")
+
+		// keep is updated before remove is deleted, so a failure leaves both
+		// records rather than losing remove's data.
+		err = c.Update(versionedID(keep), bson.M{"$set": set, "$inc": bson.M{"version": 1}})
+
+		if err != nil {
+			switch err {
+			default:
+				errorWithJSON(w, "Database error", http.StatusInternalServerError)
+				log.Println("Failed update merged electrician: ", err)
+				return
+			case mgo.ErrNotFound:
+				errorWithJSON(w, "Electrician was changed or deleted while merging, retry", http.StatusConflict)
+				return
+			}
+		}
+
+		keep.Version++
+
+		_, err = softDelete(c, remove.ID)
+
+		if err != nil && err != mgo.ErrNotFound {
+			errorWithJSON(w, "Database error", http.StatusInternalServerError)
+			log.Println("Failed remove merged electrician: ", err)
+			return
+		}
+
+		if moveOrgNumber {
+			err = c.Update(versionedID(keep), bson.M{"$set": bson.M{"orgNumber": orgNumber}, "$inc": bson.M{"version": 1}})
+
+			if err != nil {
+				switch {
+				default:
+					errorWithJSON(w, "Database error", http.StatusInternalServerError)
+					log.Println("Failed move orgNumber to merged electrician: ", err)
+					return
+				case mgo.IsDup(err):
+					errorWithJSON(w, "An electrician with this orgNumber already exists", http.StatusConflict)
+					return
+				case err == mgo.ErrNotFound:
+					errorWithJSON(w, "Electrician was changed or deleted while merging, retry", http.StatusConflict)
+					return
+				}
+			}
+
+			keep.Version++
+		}
+
+		notifyWebhooks(webhookEvent{Type: "deleted", ID: remove.ID.Hex()})
+
+		jsonData, err := json.Marshal(keep)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		responseWithJSON(w, jsonData, http.StatusOK)
+	}
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+type routeDoc struct {
+	Path        string            `json:"path"`
+	Methods     []string          `json:"methods"`
+	Description string            `json:"description"`
+	Params      map[string]string `json:"params,omitempty"`
+}
+
+var routeDocs = []routeDoc{
+	{
+		Path:        "/",
+		Methods:     []string{"GET", "POST"},
+		Description: "GET lists electricians sorted by name. POST creates an electrician (authenticated); internalNotes is only accepted from and shown to admins.",
+		Params: map[string]string{
+			"Idempotency-Key": "header, POST only: replays the original response when the same user repeats a key, 409 while the first request is still running",
+			"Prefer":          "header, POST only: return=minimal responds without a body",
+			"Content-Type":    "header, POST only: application/x-yaml to send the record as YAML instead of JSON",
+			"X-Write-Concern": "header, POST only: 0, a number of nodes up to 50 or majority",
+			"fields":          "comma-separated fields to return, dotted paths like location.coordinates select nested fields; GET defaults to the public fields, only admins can request others",
+			"countOnly":       "GET only: true to return {\"count\": n} instead of records",
+			"includeDeleted":  "GET only: true to include deleted records (admin)",
+			"coordFormat":     "GET only: object to write location as {\"lat\", \"lng\"} instead of GeoJSON",
+			"crs":             "GET only: EPSG code to reproject coordinates to, such as EPSG:25833; defaults to EPSG:4326",
+		},
+	},
+	{
+		Path:        "/health",
+		Methods:     []string{"GET"},
+		Description: "Responds 200 when the database is reachable, 503 otherwise. Served at the root instead of BASE_PATH when HEALTH_AT_ROOT is true.",
+	},
+	{
+		Path:        "/health/detail",
+		Methods:     []string{"GET"},
+		Description: "Reports the status of the database, indexes and geocoder. Only the database makes the service unhealthy.",
+	},
+	{
+		Path:        "/by-org/{orgNumber}",
+		Methods:     []string{"GET"},
+		Description: "Returns the electrician with this organization number.",
+	},
+	{
+		Path:        "/by-phone/{phone}",
+		Methods:     []string{"GET"},
+		Description: "Returns the electrician with this phone number, in any format.",
+	},
+	{
+		Path:        "/export.vcf",
+		Methods:     []string{"GET"},
+		Description: "Returns every electrician as vCard 3.0 contacts in one file (admin).",
+	},
+	{
+		Path:        "/{id}.vcf",
+		Methods:     []string{"GET"},
+		Description: "Returns an electrician as a vCard 3.0 contact.",
+	},
+	{
+		Path:        "/{id}/touch",
+		Methods:     []string{"POST"},
+		Description: "Bumps updatedAt and version without changing data (authenticated).",
+	},
+	{
+		Path:        "/search",
+		Methods:     []string{"GET", "POST"},
+		Description: "Searches electricians. POST accepts the same params as a JSON body, plus polygon.",
+		Params: map[string]string{
+			"skip":            "number of results to skip",
+			"shape":           "array (default) or map to key results by id",
+			"exclude":         "comma-separated ids to leave out of the results",
+			"fields":          "comma-separated fields to return, dotted paths select nested fields; defaults to the public fields, only admins can request others",
+			"boost":           "rating sorts geo results by a blend of rating and distance",
+			"ratingWeight":    "boost=rating only: weight of rating, default 1",
+			"distanceWeight":  "boost=rating only: weight of distance, default 1",
+			"nearest":         "returns the n closest records to lon/lat however far away, up to 100",
+			"rank":            "combined ranks text matches near lon/lat by a blend of relevance and proximity",
+			"textWeight":      "rank=combined only: weight of text relevance from 0 to 1, default 0.5",
+			"limit":           "maximum number of results",
+			"page":            "page number starting at 1, instead of skip",
+			"pageSize":        "results per page, instead of limit",
+			"text":            "full text search",
+			"exactPhrase":     "true to only match records containing text as a whole phrase, without stemming",
+			"lang":            "text search language: nb, nn, no, en or none; defaults to the Accept-Language header",
+			"hint":            "name prefix",
+			"cityHint":        "city prefix, case-insensitive",
+			"addressHint":     "address line prefix, case-insensitive",
+			"fuzzy":           "true to match text against names with typos",
+			"phone":           "phone number prefix, matched against every number in phones",
+			"orgNumber":       "exact organization number",
+			"minCompleteness": "minimum fraction of populated fields, 0 to 1",
+			"hasWebsite":      "true or false to filter on whether a website is set",
+			"hasEmail":        "true or false to filter on whether an email is set",
+			"hasPhone":        "true or false to filter on whether a phone number is set",
+			"lon":             "longitude for proximity search",
+			"lat":             "latitude for proximity search",
+			"tags":            "comma-separated tags that must all be present",
+			"buckets":         "comma-separated distances in meters to group geo results by",
+			"facets":          "comma-separated fields from city, county, zip, tags and language; responds with {\"results\", \"facets\"} holding value counts for all matches",
+			"highlight":       "true to mark text matches",
+			"highlightPre":    "opening highlight delimiter",
+			"highlightPost":   "closing highlight delimiter",
+			"countMode":       "exact, estimate, approximate or none",
+			"approxCount":     "true for countMode=approximate: counts up to 1000 and flags larger totals as estimated",
+			"idsOnly":         "true to return only an array of matching ids",
+			"envelope":        "true to wrap results as {\"data\", \"total\", \"skip\", \"limit\", ...}, also requested by Accept: application/vnd.electricians.envelope+json",
+			"region":          "name of a region from REGIONS_FILE to search within",
+			"includeDeleted":  "true to include deleted records (admin)",
+			"createdBy":       "user id that created the record (admin)",
+			"updatedBy":       "user id that last updated the record (admin)",
+			"coordFormat":     "object to write location as {\"lat\", \"lng\"} instead of GeoJSON",
+			"crs":             "EPSG code to reproject coordinates to, such as EPSG:25833; lon, lat and polygon stay EPSG:4326",
+		},
+	},
+	{
+		Path:        "/clusters",
+		Methods:     []string{"GET"},
+		Description: "Clusters electricians within a bounding box for a map zoom level.",
+		Params: map[string]string{
+			"bbox":   "minLon,minLat,maxLon,maxLat",
+			"zoom":   "map zoom level between 0 and 22",
+			"crs":    "EPSG code to reproject coordinates to; bbox stays EPSG:4326",
+			"fields": "comma-separated fields of the electricians returned at high zoom; defaults to the public fields, only admins can request others",
+		},
+	},
+	{
+		Path:        "/cities",
+		Methods:     []string{"GET"},
+		Description: "Lists distinct cities in alphabetical order.",
+		Params: map[string]string{
+			"prefix": "city prefix, case-insensitive",
+			"skip":   "number of cities to skip",
+			"limit":  "maximum number of cities, up to 1000, default 50",
+		},
+	},
+	{
+		Path:        "/cities/suggest",
+		Methods:     []string{"GET"},
+		Description: "Suggests existing cities within a few typos of q, closest and most used first.",
+		Params: map[string]string{
+			"q":     "city name to find corrections for",
+			"limit": "maximum number of suggestions, default 5",
+		},
+	},
+	{
+		Path:        "/counties",
+		Methods:     []string{"GET"},
+		Description: "Lists distinct counties in alphabetical order.",
+		Params: map[string]string{
+			"prefix": "county prefix, case-insensitive",
+			"skip":   "number of counties to skip",
+			"limit":  "maximum number of counties, up to 1000, default 50",
+		},
+	},
+	{
+		Path:        "/distance-bands",
+		Methods:     []string{"GET"},
+		Description: "Counts electricians within each distance band around a point.",
+		Params: map[string]string{
+			"lon":   "longitude",
+			"lat":   "latitude",
+			"bands": "comma-separated ascending upper bounds in meters, default 5000,10000,25000",
+		},
+	},
+	{
+		Path:        "/reverse-region",
+		Methods:     []string{"GET"},
+		Description: "Returns the name of the region from REGIONS_FILE containing a point, or 404.",
+		Params: map[string]string{
+			"lon": "longitude",
+			"lat": "latitude",
+		},
+	},
+	{
+		Path:        "/changes",
+		Methods:     []string{"GET"},
+		Description: "Lists records changed or deleted since a timestamp, oldest first.",
+		Params: map[string]string{
+			"since":  "RFC 3339 timestamp to start from",
+			"cursor": "next from the previous response, to continue instead of since",
+			"limit":  "maximum number of changes, up to 1000",
+		},
+	},
+	{
+		Path:        "/events",
+		Methods:     []string{"GET"},
+		Description: "Streams created, updated and deleted records as server-sent events.",
+		Params: map[string]string{
+			"bbox": "minLon,minLat,maxLon,maxLat to only receive events inside it",
+		},
+	},
+	{
+		Path:        "/auth/verify",
+		Methods:     []string{"GET"},
+		Description: "Verifies the bearer token and returns its claims.",
+	},
+	{
+		Path:        "/duplicates",
+		Methods:     []string{"GET"},
+		Description: "Lists groups of likely duplicate electricians (admin).",
+		Params: map[string]string{
+			"by":    "phone or nameZip",
+			"skip":  "number of groups to skip",
+			"limit": "maximum number of groups, up to 1000, default 50",
+		},
+	},
+	{
+		Path:        "/import",
+		Methods:     []string{"POST"},
+		Description: "Upserts an array of electricians by phone and returns a result per record (admin).",
+		Params: map[string]string{
+			"X-Write-Concern": "header: 0, a number of nodes up to 50 or majority",
+		},
+	},
+	{
+		Path:        "/admin/validate",
+		Methods:     []string{"GET"},
+		Description: "Runs stored records through the validators and reports the ones that fail (admin).",
+		Params: map[string]string{
+			"after": "id to continue after, use next from the previous response",
+			"limit": "number of records to check, up to 10000",
+		},
+	},
+	{
+		Path:        "/merge",
+		Methods:     []string{"POST"},
+		Description: "Merges the remove record into the keep record (admin).",
+	},
+	{
+		Path:        "/admin/reindex",
+		Methods:     []string{"POST"},
+		Description: "Drops and recreates every index except _id_ (admin).",
+	},
+	{
+		Path:        "/admin/geocode-missing",
+		Methods:     []string{"POST"},
+		Description: "Geocodes records without coordinates using GEOCODER_URL (admin).",
+		Params: map[string]string{
+			"batch":       "number of records to geocode",
+			"retryFailed": "true to retry records that failed to geocode before",
+		},
+	},
+	{
+		Path:        "/admin/coordinates",
+		Methods:     []string{"POST"},
+		Description: "Applies an array of {\"id\", \"coordinates\"} in one bulk write and returns a result per record (admin).",
+	},
+	{
+		Path:        "/admin/tag",
+		Methods:     []string{"POST"},
+		Description: "Adds and removes tags on many records, with a body of {\"ids\", \"add\", \"remove\"} (admin).",
+	},
+	{
+		Path:        "/admin/dump",
+		Methods:     []string{"GET"},
+		Description: "Streams every record, deleted ones included, as newline-delimited JSON (admin).",
+	},
+	{
+		Path:        "/admin/restore",
+		Methods:     []string{"POST"},
+		Description: "Loads a newline-delimited JSON dump (admin).",
+		Params: map[string]string{
+			"mode":            "merge (default) upserts by id; replace removes every record first",
+			"confirm":         "mode=replace only: the collection name",
+			"X-Write-Concern": "header: 0, a number of nodes up to 50 or majority",
+		},
+	},
+	{
+		Path:        "/admin/cache",
+		Methods:     []string{"GET"},
+		Description: "Returns response cache statistics (admin).",
+	},
+	{
+		Path:        "/admin/read-only",
+		Methods:     []string{"POST"},
+		Description: "Turns read-only mode on or off with a body of {\"enabled\": true} (admin).",
+	},
+	// /{id} matches any single segment, so it has to come after the static
+	// paths for them to get their own OPTIONS response.
+	{
+		Path:        "/{id}",
+		Methods:     []string{"GET", "PATCH", "DELETE"},
+		Description: "GET returns an electrician with its completeness score. PATCH applies an application/merge-patch+json document, where null removes a field, and returns the updated record (authenticated). DELETE deletes it and returns the deleted record (authenticated).",
+		Params: map[string]string{
+			"fields":      "GET only: comma-separated fields to return, dotted paths select nested fields; defaults to the public fields, only admins can request others",
+			"coordFormat": "GET only: object to write location as {\"lat\", \"lng\"} instead of GeoJSON",
+			"crs":         "GET only: EPSG code to reproject coordinates to, such as EPSG:25833; defaults to EPSG:4326",
+		},
+	},
+}
+
+func describeRoute(doc routeDoc) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Allow", strings.Join(append(doc.Methods, "OPTIONS"), ", "))
+
+		jsonData, _ := json.Marshal(doc)
+		responseWithJSON(w, jsonData, http.StatusOK)
+	}
+}
+
+func handleOptions(router *mux.Router) {
+	for _, doc := range routeDocs {
+		router.HandleFunc(doc.Path, describeRoute(doc)).Methods("OPTIONS")
+	}
+}
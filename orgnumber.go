@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// orgNumberPatterns are the organization number formats per country, after
+// normalizeOrgNumber has removed separators.
+var orgNumberPatterns = map[string]string{
+	"NO": `^\d{9}$`,
+	"SE": `^\d{10}$`,
+	"DK": `^\d{8}$`,
+	"FI": `^\d{8}$`,
+}
+
+// orgNumberPattern is chosen by ORG_NUMBER_COUNTRY (default NO), or given
+// directly as a regular expression in ORG_NUMBER_PATTERN.
+var orgNumberPattern = regexp.MustCompile(orgNumberPatterns["NO"])
+
+func initOrgNumberFormat() {
+	if pattern := os.Getenv("ORG_NUMBER_PATTERN"); pattern != "" {
+		orgNumberPattern = regexp.MustCompile(pattern)
+		return
+	}
+
+	country := os.Getenv("ORG_NUMBER_COUNTRY")
+
+	if country == "" {
+		return
+	}
+
+	pattern, ok := orgNumberPatterns[strings.ToUpper(country)]
+
+	if !ok {
+		panic("Unsupported ORG_NUMBER_COUNTRY: " + country)
+	}
+
+	orgNumberPattern = regexp.MustCompile(pattern)
+}
+
+// normalizeOrgNumber removes spaces, dots and dashes, and the MVA suffix
+// Norwegian VAT-registered businesses often add.
+func normalizeOrgNumber(value string) string {
+	value = strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(value)), "MVA")
+	return strings.NewReplacer(" ", "", ".", "", "-", "").Replace(value)
+}
+
+func validOrgNumber(value string) bool {
+	return orgNumberPattern.MatchString(value)
+}
+
+// orgNumberIndex only covers live records, so a deleted business can be
+// created again and merge can move an orgNumber off the removed record.
+func orgNumberIndex() mgo.Index {
+	return mgo.Index{
+		Key:    []string{"orgNumber"},
+		Unique: true,
+		PartialFilter: bson.M{
+			"deletedAt": bson.M{"$exists": false},
+			"orgNumber": bson.M{"$exists": true},
+		},
+	}
+}
+
+func getByOrgNumber(s *mgo.Session) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session := readSession(s)
+		defer session.Close()
+
+		vars := mux.Vars(r)
+		orgNumber := normalizeOrgNumber(vars["orgNumber"])
+
+		if !validOrgNumber(orgNumber) {
+			errorWithJSON(w, "Invalid orgNumber", http.StatusBadRequest)
+			return
+		}
+
+		lookupOne(w, r, session, bson.M{"orgNumber": orgNumber})
+	}
+}
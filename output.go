@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+const coordFormatObject string = "object"
+
+// prepareElectrician applies the per-request output options to a record
+// about to be written in a response.
+func prepareElectrician(r *http.Request, e *electrician) {
+	stripRestrictedOne(r, e)
+
+	if r.URL.Query().Get("coordFormat") == coordFormatObject {
+		e.Location.latLng = true
+	}
+
+	e.Location.Coordinates = projectCoordinates(r, e.Location.Coordinates)
+}
+
+func prepareElectricians(r *http.Request, electricians []electrician) {
+	for i := range electricians {
+		prepareElectrician(r, &electricians[i])
+	}
+}
+
+// MarshalJSON writes {"lat": .., "lng": ..} for coordFormat=object and the
+// stored GeoJSON coordinates otherwise.
+func (g geo) MarshalJSON() ([]byte, error) {
+	if g.latLng && len(g.Coordinates) == 2 {
+		return json.Marshal(struct {
+			Lat float64 `json:"lat"`
+			Lng float64 `json:"lng"`
+		}{g.Coordinates[1], g.Coordinates[0]})
+	}
+
+	return json.Marshal(struct {
+		Coordinates []float64 `json:"coordinates"`
+	}{g.Coordinates})
+}
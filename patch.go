@@ -0,0 +1,313 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stianba/auth-service/token"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// mutableFields are the fields a PATCH may change. JSON and BSON names are
+// the same for all of them.
+var mutableFields = map[string]bool{
+	"name":          true,
+	"addressLine1":  true,
+	"addressLine2":  true,
+	"city":          true,
+	"county":        true,
+	"zip":           true,
+	"phone":         true,
+	"phones":        true,
+	"website":       true,
+	"email":         true,
+	"orgNumber":     true,
+	"location":      true,
+	"tags":          true,
+	"language":      true,
+	"rating":        true,
+	"internalNotes": true,
+}
+
+// mergePatch applies an RFC 7386 JSON Merge Patch to target: null removes a
+// member, objects are merged recursively and anything else replaces it.
+func mergePatch(target interface{}, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+
+	if !ok {
+		targetObject = make(map[string]interface{})
+	}
+
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+		} else {
+			targetObject[key] = mergePatch(targetObject[key], value)
+		}
+	}
+
+	return targetObject
+}
+
+// patchFieldErrors returns the patched fields the caller may not change.
+func patchFieldErrors(r *http.Request, patch map[string]interface{}) map[string]string {
+	fields := make(map[string]string)
+	level := permissionLevel(r)
+
+	for key := range patch {
+		if !mutableFields[key] {
+			fields[key] = "not_mutable"
+		}
+	}
+
+	for _, field := range restrictedFields {
+		if _, ok := patch[field.Name]; ok && level < field.Level {
+			fields[field.Name] = "forbidden"
+		}
+	}
+
+	return fields
+}
+
+// applyMergePatch returns current with patch applied, normalized the same way
+// as a created record.
+func applyMergePatch(current electrician, patch map[string]interface{}) (updated electrician, err error) {
+	currentJSON, err := json.Marshal(current)
+
+	if err != nil {
+		return
+	}
+
+	var document interface{}
+	err = json.Unmarshal(currentJSON, &document)
+
+	if err != nil {
+		return
+	}
+
+	patchedJSON, err := json.Marshal(mergePatch(document, patch))
+
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(patchedJSON, &updated)
+
+	if err != nil {
+		return
+	}
+
+	_, phoneChanged := patch["phone"]
+	_, phonesChanged := patch["phones"]
+
+	// phone mirrors the first of phones, so a patch of only phone replaces
+	// or, for null, removes that entry.
+	if phoneChanged && !phonesChanged && len(updated.Phones) > 0 {
+		if updated.Phone == "" {
+			updated.Phones = updated.Phones[1:]
+		} else {
+			updated.Phones[0].Number = updated.Phone
+		}
+	}
+
+	syncPhones(&updated)
+	syncPrefixFields(&updated)
+	updated.OrgNumber = normalizeOrgNumber(updated.OrgNumber)
+	updated.Location.Type = "Point"
+
+	if language, ok := textLanguage(updated.Language); ok {
+		updated.Language = language
+	}
+
+	if _, ok := patch["location"]; ok {
+		updated.GeocodeSource = ""
+
+		if len(updated.Location.Coordinates) > 0 {
+			updated.GeocodeSource = geocodeSourceUser
+		}
+	}
+
+	return
+}
+
+// patchUpdate sets the patched fields to their values in updated and unsets
+// those the patch removed or that are now empty and stored with omitempty.
+func patchUpdate(updated electrician, patch map[string]interface{}, userID string) (bson.M, error) {
+	data, err := bson.Marshal(updated)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var doc bson.M
+	err = bson.Unmarshal(data, &doc)
+
+	if err != nil {
+		return nil, err
+	}
+
+	changed := make(map[string]bool)
+
+	for key := range patch {
+		changed[key] = true
+	}
+
+	if changed["phone"] || changed["phones"] {
+		changed["phone"], changed["phones"] = true, true
+	}
+
+	if changed["location"] {
+		changed["geocodeSource"] = true
+	}
+
+	for field, lower := range prefixFields {
+		if changed[field] {
+			changed[lower] = true
+		}
+	}
+
+	set := bson.M{"updatedAt": time.Now(), "updatedBy": userID}
+	unset := bson.M{}
+
+	for key := range changed {
+		value, ok := doc[key]
+		patchValue, patched := patch[key]
+
+		// phone and phones are derived from each other, so they are unset
+		// only when nothing is left rather than whenever the patch has null.
+		removed := patched && patchValue == nil && key != "phone" && key != "phones"
+		empty := !ok || key == "location" && len(updated.Location.Coordinates) == 0 || key == "phone" && updated.Phone == ""
+
+		if removed || empty {
+			unset[key] = ""
+		} else {
+			set[key] = value
+		}
+	}
+
+	update := bson.M{"$set": set, "$inc": bson.M{"version": 1}}
+
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	return update, nil
+}
+
+func patchElectrician(s *mgo.Session) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session := requestSession(s)
+		defer session.Close()
+
+		vars := mux.Vars(r)
+		id := vars["id"]
+
+		if !bson.IsObjectIdHex(id) {
+			errorWithJSON(w, "Invalid id", http.StatusBadRequest)
+			return
+		}
+
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+		if mediaType != "application/merge-patch+json" {
+			errorWithJSON(w, "Content-Type must be application/merge-patch+json", http.StatusUnsupportedMediaType)
+			return
+		}
+
+		var patch map[string]interface{}
+		err := json.NewDecoder(r.Body).Decode(&patch)
+
+		if err != nil || patch == nil {
+			errorWithJSON(w, "Incorrect body", http.StatusBadRequest)
+			return
+		}
+
+		if fields := patchFieldErrors(r, patch); len(fields) > 0 {
+			validationErrorWithJSON(w, fields)
+			return
+		}
+
+		var current electrician
+
+		c := session.DB(os.Getenv("DB_NAME")).C(collection)
+		err = c.Find(activeID(bson.ObjectIdHex(id))).One(&current)
+
+		if err != nil {
+			switch err {
+			default:
+				errorWithJSON(w, "Database error", http.StatusInternalServerError)
+				log.Println("Failed get electrician: ", err)
+				return
+			case mgo.ErrNotFound:
+				errorWithJSON(w, "Electrician not found", http.StatusNotFound)
+				return
+			}
+		}
+
+		updated, err := applyMergePatch(current, patch)
+
+		if coordinateErr, ok := err.(*coordinateError); ok {
+			validationErrorWithJSON(w, map[string]string{"location": coordinateErr.Error()})
+			return
+		}
+
+		if err != nil {
+			errorWithJSON(w, "Incorrect body", http.StatusBadRequest)
+			return
+		}
+
+		if fields := validateElectrician(updated); len(fields) > 0 {
+			validationErrorWithJSON(w, fields)
+			return
+		}
+
+		update, err := patchUpdate(updated, patch, token.GetContext(r).ID)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// Matching on version makes the update fail if the record changed
+		// since it was read, instead of overwriting that change.
+		var patched electrician
+		_, err = c.Find(versionedID(current)).Apply(mgo.Change{Update: update, ReturnNew: true}, &patched)
+
+		if err != nil {
+			switch {
+			default:
+				errorWithJSON(w, "Database error", http.StatusInternalServerError)
+				log.Println("Failed patch electrician: ", err)
+				return
+			case mgo.IsDup(err):
+				errorWithJSON(w, "An electrician with this orgNumber already exists", http.StatusConflict)
+				return
+			case err == mgo.ErrNotFound:
+				errorWithJSON(w, "Electrician was changed or deleted while patching, retry", http.StatusConflict)
+				return
+			}
+		}
+
+		notifyWebhooks(webhookEvent{Type: "updated", ID: id, Electrician: &patched})
+
+		prepareElectrician(r, &patched)
+		jsonData, err := marshalFields(patched, parseFields(r.URL.Query().Get("fields")))
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		responseWithJSON(w, jsonData, http.StatusOK)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"strings"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// normalizePhone strips everything but digits, keeping a leading + for country codes.
+func normalizePhone(phone string) string {
+	phone = strings.TrimSpace(phone)
+	var b strings.Builder
+
+	for i, r := range phone {
+		if r >= '0' && r <= '9' || r == '+' && i == 0 {
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
+
+const primaryPhoneLabel string = "primary"
+
+type phoneNumber struct {
+	Label  string `json:"label" bson:"label"`
+	Number string `json:"number" bson:"number"`
+}
+
+// syncPhones normalizes every number and keeps the deprecated phone field
+// equal to the first entry in phones. A record with only phone gets it as its
+// single primary entry.
+func syncPhones(e *electrician) {
+	e.Phone = normalizePhone(e.Phone)
+
+	for i := range e.Phones {
+		e.Phones[i].Number = normalizePhone(e.Phones[i].Number)
+	}
+
+	if len(e.Phones) == 0 && e.Phone != "" {
+		e.Phones = []phoneNumber{{Label: primaryPhoneLabel, Number: e.Phone}}
+	}
+
+	if len(e.Phones) > 0 {
+		e.Phone = e.Phones[0].Number
+	}
+}
+
+type storedElectrician electrician
+
+// SetBSON migrates records stored before phones existed as they are read.
+func (e *electrician) SetBSON(raw bson.Raw) error {
+	err := raw.Unmarshal((*storedElectrician)(e))
+
+	if err != nil {
+		return err
+	}
+
+	if len(e.Phones) == 0 && e.Phone != "" {
+		e.Phones = []phoneNumber{{Label: primaryPhoneLabel, Number: e.Phone}}
+	}
+
+	return nil
+}
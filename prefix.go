@@ -0,0 +1,103 @@
+package main
+
+import (
+	"log"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const prefixBackfillBatch int = 1000
+
+// prefixFields maps the fields searched by prefix to lower-cased copies.
+// Case-insensitive regexes can't use index bounds, while an anchored
+// case-sensitive regex over a lower-cased copy can.
+var prefixFields = map[string]string{
+	"city":         "cityLower",
+	"county":       "countyLower",
+	"addressLine1": "addressLine1Lower",
+	"addressLine2": "addressLine2Lower",
+}
+
+// syncPrefixFields sets the lower-cased copies of the prefix searched fields.
+func syncPrefixFields(e *electrician) {
+	e.CityLower = strings.ToLower(e.City)
+	e.CountyLower = strings.ToLower(e.County)
+	e.AddressLine1Lower = strings.ToLower(e.AddressLine1)
+	e.AddressLine2Lower = strings.ToLower(e.AddressLine2)
+}
+
+// prefixValues returns the lower-cased copies of e for a $set.
+func prefixValues(e electrician) bson.M {
+	return bson.M{
+		"cityLower":         e.CityLower,
+		"countyLower":       e.CountyLower,
+		"addressLine1Lower": e.AddressLine1Lower,
+		"addressLine2Lower": e.AddressLine2Lower,
+	}
+}
+
+// prefixQuery matches records where field starts with prefix, ignoring case.
+func prefixQuery(field, prefix string) bson.M {
+	pattern := bson.RegEx{Pattern: "^" + regexp.QuoteMeta(strings.ToLower(prefix))}
+	return bson.M{prefixFields[field]: pattern}
+}
+
+// backfillPrefixFields sets the lower-cased copies on records stored before
+// they existed. Records written since are kept in sync, so this only does
+// work once.
+func backfillPrefixFields(s *mgo.Session) {
+	session := s.Copy()
+	defer session.Close()
+
+	missing := make([]bson.M, 0, len(prefixFields))
+
+	for field, lower := range prefixFields {
+		missing = append(missing, bson.M{field: bson.M{"$nin": []interface{}{"", nil}}, lower: bson.M{"$exists": false}})
+	}
+
+	c := session.DB(os.Getenv("DB_NAME")).C(collection)
+	iter := c.Find(bson.M{"$or": missing}).Iter()
+	bulk := c.Bulk()
+	bulk.Unordered()
+	queued, total := 0, 0
+
+	var e electrician
+
+	for iter.Next(&e) {
+		syncPrefixFields(&e)
+		bulk.Update(bson.M{"_id": e.ID}, bson.M{"$set": prefixValues(e)})
+		queued++
+
+		if queued == prefixBackfillBatch {
+			if _, err := bulk.Run(); err != nil {
+				panic(err)
+			}
+
+			total += queued
+			bulk, queued = c.Bulk(), 0
+			bulk.Unordered()
+		}
+
+		e = electrician{}
+	}
+
+	if err := iter.Close(); err != nil {
+		panic(err)
+	}
+
+	if queued > 0 {
+		if _, err := bulk.Run(); err != nil {
+			panic(err)
+		}
+
+		total += queued
+	}
+
+	if total > 0 {
+		log.Printf("Backfilled lower-cased prefix fields on %v records\n", total)
+	}
+}
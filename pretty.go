@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+type prettyWriter struct {
+	http.ResponseWriter
+}
+
+// Write indents each JSON document written by responseWithJSON and passes
+// other content types, and anything that is not valid JSON, through
+// unchanged.
+func (pw prettyWriter) Write(b []byte) (int, error) {
+	if !strings.HasPrefix(pw.Header().Get("Content-Type"), "application/json") {
+		return pw.ResponseWriter.Write(b)
+	}
+
+	var out bytes.Buffer
+
+	if json.Indent(&out, b, "", "  ") != nil {
+		return pw.ResponseWriter.Write(b)
+	}
+
+	out.WriteByte('\n')
+	_, err := pw.ResponseWriter.Write(out.Bytes())
+	return len(b), err
+}
+
+// Flush forwards to the wrapped writer, so handlers that flush still work
+// with pretty=true.
+func (pw prettyWriter) Flush() {
+	if flusher, ok := pw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func prettyJSON(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Streaming routes write NDJSON and SSE in chunks, which must not
+		// be reformatted.
+		if r.URL.Query().Get("pretty") == "true" && !streamingPaths[r.URL.Path] {
+			w = prettyWriter{w}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
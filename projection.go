@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// publicFields are the fields read endpoints return by default. Fields added
+// to electrician stay hidden until listed here, or in PUBLIC_FIELDS.
+var publicFields = []string{
+	"name", "addressLine1", "addressLine2", "city", "county", "zip",
+	"phone", "phones", "website", "email", "orgNumber", "location",
+	"geocodeSource", "tags", "language", "rating", "createdAt", "updatedAt",
+	"completeness", "score", "deletedAt",
+}
+
+// initPublicFields replaces publicFields with the comma-separated
+// PUBLIC_FIELDS, or with every field when it is "*".
+func initPublicFields() {
+	value := os.Getenv("PUBLIC_FIELDS")
+
+	if value == "" {
+		return
+	}
+
+	publicFields = nil
+
+	if value != "*" {
+		publicFields = parseFields(value)
+	}
+}
+
+// parseFields reads a comma-separated fields param. An empty value means all fields.
+func parseFields(value string) []string {
+	var fields []string
+
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+
+		if field != "" {
+			fields = append(fields, field)
+		}
+	}
+
+	return fields
+}
+
+// responseFields returns the fields a read response should contain: the
+// public fields by default, or the requested fields. Only admins can request
+// fields outside the public set.
+func responseFields(r *http.Request) []string {
+	requested := parseFields(r.URL.Query().Get("fields"))
+
+	if len(requested) == 0 {
+		return publicFields
+	}
+
+	if publicFields == nil || permissionLevel(r) >= adminPermissionLevel {
+		return requested
+	}
+
+	public := make(map[string]bool, len(publicFields))
+
+	for _, field := range publicFields {
+		public[field] = true
+	}
+
+	fields := []string{"_id"}
+
+	for _, field := range requested {
+		if public[strings.SplitN(field, ".", 2)[0]] {
+			fields = append(fields, field)
+		}
+	}
+
+	return fields
+}
+
+// projectObject keeps the given fields of a JSON object. Dotted fields such as
+// location.coordinates keep only that part of a nested object.
+func projectObject(data json.RawMessage, fields []string) (json.RawMessage, error) {
+	var doc map[string]json.RawMessage
+
+	err := json.Unmarshal(data, &doc)
+
+	if err != nil {
+		return nil, err
+	}
+
+	whole := make(map[string]bool)
+	nested := make(map[string][]string)
+
+	for _, field := range fields {
+		parts := strings.SplitN(field, ".", 2)
+
+		if len(parts) == 1 {
+			whole[field] = true
+		} else {
+			nested[parts[0]] = append(nested[parts[0]], parts[1])
+		}
+	}
+
+	projected := make(map[string]json.RawMessage)
+
+	for field, value := range doc {
+		if whole[field] {
+			projected[field] = value
+		} else if subfields, ok := nested[field]; ok && bytes.HasPrefix(bytes.TrimSpace(value), []byte("{")) {
+			projected[field], err = projectObject(value, subfields)
+
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return json.Marshal(projected)
+}
+
+// marshalFields marshals v, or each element when v is a list, keeping only the
+// given JSON fields and _id.
+func marshalFields(v interface{}, fields []string) ([]byte, error) {
+	jsonData, err := json.Marshal(v)
+
+	if err != nil || len(fields) == 0 {
+		return jsonData, err
+	}
+
+	// fields is often publicFields itself, so never append in place.
+	fields = append(fields[:len(fields):len(fields)], "_id")
+
+	if !bytes.HasPrefix(jsonData, []byte("[")) {
+		return projectObject(jsonData, fields)
+	}
+
+	var docs []json.RawMessage
+
+	err = json.Unmarshal(jsonData, &docs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range docs {
+		docs[i], err = projectObject(docs[i], fields)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return json.Marshal(docs)
+}
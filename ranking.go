@@ -0,0 +1,121 @@
+package main
+
+import (
+	"math"
+	"sort"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	rankCombined string  = "combined"
+	boostRating  string  = "rating"
+	maxRating    float64 = 5
+
+	// Like fuzzy search, combined ranking scores candidates in memory, so only
+	// the rankCandidateLimit most relevant text matches within range are
+	// considered.
+	rankCandidateLimit int     = 5000
+	defaultTextWeight  float64 = 0.5
+	earthRadius        float64 = 6378100
+)
+
+type rankCandidate struct {
+	Electrician electrician `bson:",inline"`
+	TextScore   float64     `bson:"textScore"`
+}
+
+type rankedMatch struct {
+	electrician electrician
+	score       float64
+}
+
+// ratingBoostStage scores geo results by ratingWeight * rating/maxRating -
+// distanceWeight * distance/maxDistance and sorts by it, so well-rated records
+// can overtake closer ones. Unrated records count as rated zero.
+func ratingBoostStage(params searchParams, maxDistance float64) []bson.M {
+	rating := bson.M{"$divide": []interface{}{bson.M{"$ifNull": []interface{}{"$rating", 0}}, maxRating}}
+	distance := bson.M{"$divide": []interface{}{"$distance", maxDistance}}
+
+	score := bson.M{"$addFields": bson.M{"geoScore": bson.M{"$subtract": []interface{}{
+		bson.M{"$multiply": []interface{}{params.RatingWeight, rating}},
+		bson.M{"$multiply": []interface{}{params.DistanceWeight, distance}},
+	}}}}
+
+	sort := bson.M{"$sort": bson.D{{Name: "geoScore", Value: -1}, {Name: "_id", Value: 1}}}
+	return []bson.M{score, sort}
+}
+
+// haversine returns the distance in meters between two [lon, lat] positions.
+func haversine(a, b []float64) float64 {
+	lon1, lat1 := a[0]*math.Pi/180, a[1]*math.Pi/180
+	lon2, lat2 := b[0]*math.Pi/180, b[1]*math.Pi/180
+
+	h := math.Pow(math.Sin((lat2-lat1)/2), 2) + math.Cos(lat1)*math.Cos(lat2)*math.Pow(math.Sin((lon2-lon1)/2), 2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(h))
+}
+
+// combinedSearch ranks text matches within LocationScope of lon/lat by
+// textWeight * relevance + (1 - textWeight) * proximity, both scaled to 0-1.
+// $text and $geoNear can't share a pipeline, so distance is computed here.
+func combinedSearch(c *mgo.Collection, params searchParams) ([]electrician, int, error) {
+	near := []float64{params.Lon, params.Lat}
+	scope := float64(params.LocationScope)
+	params.locationSet = false
+
+	var candidates []rankCandidate
+
+	pipes := append(buildSearchPipes(params),
+		bson.M{"$match": bson.M{"location": bson.M{"$geoWithin": bson.M{
+			"$centerSphere": []interface{}{near, scope / earthRadius},
+		}}}},
+		bson.M{"$addFields": bson.M{"textScore": bson.M{"$meta": "textScore"}}},
+		bson.M{"$sort": bson.D{{Name: "textScore", Value: bson.M{"$meta": "textScore"}}, {Name: "_id", Value: 1}}},
+		bson.M{"$limit": rankCandidateLimit},
+	)
+	err := c.Pipe(pipes).All(&candidates)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	maxTextScore := 0.0
+
+	for _, candidate := range candidates {
+		maxTextScore = math.Max(maxTextScore, candidate.TextScore)
+	}
+
+	matches := make([]rankedMatch, 0, len(candidates))
+
+	for _, candidate := range candidates {
+		relevance := 0.0
+
+		if maxTextScore > 0 {
+			relevance = candidate.TextScore / maxTextScore
+		}
+
+		proximity := 0.0
+
+		if len(candidate.Electrician.Location.Coordinates) == 2 {
+			proximity = math.Max(0, 1-haversine(near, candidate.Electrician.Location.Coordinates)/scope)
+		}
+
+		score := params.TextWeight*relevance + (1-params.TextWeight)*proximity
+		matches = append(matches, rankedMatch{candidate.Electrician, score})
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].score > matches[j].score
+	})
+
+	result := make([]electrician, 0)
+
+	for i := params.Skip; i < len(matches) && len(result) < params.Limit; i++ {
+		score := matches[i].score
+		matches[i].electrician.Score = &score
+		result = append(result, matches[i].electrician)
+	}
+
+	return result, len(matches), nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// rateLimiter counts requests per client IP in fixed windows. The counts are
+// reset for everyone when a new window starts.
+type rateLimiter struct {
+	mu      sync.Mutex
+	limit   int
+	window  time.Duration
+	enforce bool
+	started time.Time
+	counts  map[string]int
+}
+
+// limiter is nil when RATE_LIMIT is unset.
+var limiter *rateLimiter
+
+func initRateLimit() {
+	value := os.Getenv("RATE_LIMIT")
+
+	if value == "" {
+		return
+	}
+
+	limit, err := strconv.Atoi(value)
+
+	if err != nil {
+		panic(err)
+	}
+
+	window := time.Minute
+
+	if value := os.Getenv("RATE_LIMIT_WINDOW"); value != "" {
+		window, err = time.ParseDuration(value)
+
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	limiter = &rateLimiter{
+		limit:   limit,
+		window:  window,
+		enforce: os.Getenv("RATE_LIMIT_ENFORCE") == "true",
+		counts:  make(map[string]int),
+	}
+}
+
+// take counts a request from ip and returns how many are left in the
+// current window and when it resets.
+func (rl *rateLimiter) take(ip string) (remaining int, reset time.Time) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := time.Now()
+
+	if now.Sub(rl.started) >= rl.window {
+		rl.started = now.Truncate(rl.window)
+		rl.counts = make(map[string]int)
+	}
+
+	rl.counts[ip]++
+	return rl.limit - rl.counts[ip], rl.started.Add(rl.window)
+}
+
+// withRateLimit reports usage in X-RateLimit headers on every response. Only
+// with RATE_LIMIT_ENFORCE=true are clients over the limit refused with 429.
+func withRateLimit(next http.Handler) http.Handler {
+	if limiter == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		remaining, reset := limiter.take(clientIP(r))
+
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limiter.limit))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(maxInt(remaining, 0)))
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+
+		if remaining < 0 && limiter.enforce {
+			w.Header().Set("Retry-After", strconv.Itoa(int(time.Until(reset).Seconds())+1))
+			errorWithJSON(w, "rate_limited", http.StatusTooManyRequests)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+
+	return b
+}
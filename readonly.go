@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"sync/atomic"
+)
+
+const readOnlyRetryAfter string = "300"
+
+var readOnly int32
+
+func initReadOnly() {
+	if os.Getenv("READ_ONLY") == "true" {
+		setReadOnly(true)
+	}
+}
+
+func isReadOnly() bool {
+	return atomic.LoadInt32(&readOnly) == 1
+}
+
+func setReadOnly(enabled bool) {
+	var v int32
+
+	if enabled {
+		v = 1
+	}
+
+	atomic.StoreInt32(&readOnly, v)
+}
+
+func writable(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isReadOnly() {
+			w.Header().Set("Retry-After", readOnlyRetryAfter)
+			errorWithJSON(w, "read_only_mode", http.StatusServiceUnavailable)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func toggleReadOnly(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Enabled bool `json:"enabled"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&body)
+
+	if err != nil {
+		errorWithJSON(w, "Incorrect body", http.StatusBadRequest)
+		return
+	}
+
+	setReadOnly(body.Enabled)
+
+	jsonData, _ := json.Marshal(map[string]bool{"readOnly": isReadOnly()})
+	responseWithJSON(w, jsonData, http.StatusOK)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+)
+
+type regionFile struct {
+	Features []struct {
+		Properties struct {
+			Name string `json:"name"`
+		} `json:"properties"`
+		Geometry map[string]interface{} `json:"geometry"`
+	} `json:"features"`
+}
+
+// regions maps lower-cased region names from REGIONS_FILE, a GeoJSON
+// FeatureCollection of Polygon or MultiPolygon features, to their geometry.
+var regions = map[string]map[string]interface{}{}
+
+// regionNames holds the region names as written in REGIONS_FILE, in file
+// order, so reverse lookups are deterministic for overlapping regions.
+var regionNames []string
+
+func initRegions() {
+	path := os.Getenv("REGIONS_FILE")
+
+	if path == "" {
+		return
+	}
+
+	data, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		panic(err)
+	}
+
+	var file regionFile
+
+	err = json.Unmarshal(data, &file)
+
+	if err != nil {
+		panic(err)
+	}
+
+	for i, feature := range file.Features {
+		geometryType, _ := feature.Geometry["type"].(string)
+
+		if feature.Properties.Name == "" || (geometryType != "Polygon" && geometryType != "MultiPolygon") {
+			panic(fmt.Errorf("region %v in %v needs a name and a Polygon or MultiPolygon geometry", i, path))
+		}
+
+		regions[strings.ToLower(feature.Properties.Name)] = feature.Geometry
+		regionNames = append(regionNames, feature.Properties.Name)
+	}
+
+	log.Printf("Loaded %v regions", len(regions))
+}
+
+func lookupRegion(name string) (map[string]interface{}, bool) {
+	geometry, ok := regions[strings.ToLower(strings.TrimSpace(name))]
+	return geometry, ok
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestRemoveInvalidID(t *testing.T) {
+	router := mux.NewRouter()
+	// A malformed id must be rejected before the database is touched, so no
+	// session is needed.
+	router.HandleFunc("/{id}", remove(nil)).Methods("DELETE")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("DELETE", "/not-a-hex", nil))
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status %v, got %v", http.StatusBadRequest, w.Code)
+	}
+
+	if !strings.Contains(w.Body.String(), "Invalid id") {
+		t.Errorf("expected an invalid id message, got %s", w.Body.String())
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	restoreModeMerge   string = "merge"
+	restoreModeReplace string = "replace"
+)
+
+type restoreResult struct {
+	Mode    string `json:"mode"`
+	Read    int    `json:"read"`
+	Removed int    `json:"removed"`
+	Written int    `json:"written"`
+	Failed  int    `json:"failed"`
+}
+
+// readNDJSON decodes the whole body up front so a malformed line is reported
+// before anything is written or, in replace mode, removed.
+func readNDJSON(body io.Reader) ([]electrician, error) {
+	electricians := make([]electrician, 0)
+	decoder := json.NewDecoder(body)
+
+	for line := 1; ; line++ {
+		var e electrician
+		err := decoder.Decode(&e)
+
+		if err == io.EOF {
+			return electricians, nil
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("Incorrect body at record %v", line)
+		}
+
+		if !e.ID.Valid() {
+			e.ID = bson.NewObjectId()
+		}
+
+		if len(e.Location.Coordinates) > 0 {
+			e.Location.Type = "Point"
+		}
+
+		syncPrefixFields(&e)
+		e.Completeness = nil
+		e.Score = nil
+		electricians = append(electricians, e)
+	}
+}
+
+// restore loads an NDJSON dump. merge upserts by _id; replace removes every
+// record first and requires ?confirm=<collection> to guard against accidents.
+func restore(s *mgo.Session) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session := s.Copy()
+		defer session.Close()
+
+		if err := requestWriteConcern(session, r); err != nil {
+			errorWithJSON(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		queries := r.URL.Query()
+		mode := restoreModeMerge
+
+		modeQuery, ok := queries["mode"]
+
+		if ok {
+			if len(modeQuery) > 0 {
+				mode = modeQuery[0]
+			}
+		}
+
+		if mode != restoreModeMerge && mode != restoreModeReplace {
+			errorWithJSON(w, "mode must be merge or replace", http.StatusBadRequest)
+			return
+		}
+
+		if mode == restoreModeReplace && queries.Get("confirm") != collection {
+			errorWithJSON(w, fmt.Sprintf("mode=replace removes every record; confirm with confirm=%v", collection), http.StatusBadRequest)
+			return
+		}
+
+		electricians, err := readNDJSON(r.Body)
+
+		if err != nil {
+			errorWithJSON(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		c := session.DB(os.Getenv("DB_NAME")).C(collection)
+		result := restoreResult{Mode: mode, Read: len(electricians)}
+
+		if mode == restoreModeReplace {
+			info, err := c.RemoveAll(nil)
+
+			if err != nil {
+				errorWithJSON(w, "Database error", http.StatusInternalServerError)
+				log.Println("Failed remove electricians: ", err)
+				return
+			}
+
+			result.Removed = info.Removed
+		}
+
+		for start := 0; start < len(electricians); start += maxImportSize {
+			end := minInt(start+maxImportSize, len(electricians))
+
+			bulk := c.Bulk()
+			bulk.Unordered()
+
+			for _, e := range electricians[start:end] {
+				if mode == restoreModeReplace {
+					bulk.Insert(e)
+				} else {
+					bulk.Upsert(bson.M{"_id": e.ID}, e)
+				}
+			}
+
+			_, err = bulk.Run()
+			failed := 0
+
+			if bulkErr, ok := err.(*mgo.BulkError); ok {
+				failed = len(bulkErr.Cases())
+			} else if err != nil {
+				errorWithJSON(w, "Database error", http.StatusInternalServerError)
+				log.Println("Failed restore electricians: ", err)
+				return
+			}
+
+			result.Written += end - start - failed
+			result.Failed += failed
+		}
+
+		jsonData, err := json.Marshal(result)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		responseWithJSON(w, jsonData, http.StatusOK)
+	}
+}
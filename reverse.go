@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const regionCollection string = "regions"
+
+type storedRegion struct {
+	Name     string                 `bson:"_id"`
+	Order    int                    `bson:"order"`
+	Geometry map[string]interface{} `bson:"geometry"`
+}
+
+// syncRegionCollection stores the regions from REGIONS_FILE with a 2dsphere
+// index, so reverse lookups use the same spherical geometry as the region
+// search param's $geoWithin rather than planar math.
+func syncRegionCollection(s *mgo.Session) {
+	if len(regionNames) == 0 {
+		return
+	}
+
+	session := s.Copy()
+	defer session.Close()
+
+	c := session.DB(os.Getenv("DB_NAME")).C(regionCollection)
+
+	err := c.EnsureIndex(mgo.Index{Key: []string{"$2dsphere:geometry"}})
+
+	if err != nil {
+		panic(err)
+	}
+
+	for i, name := range regionNames {
+		geometry, _ := lookupRegion(name)
+		_, err = c.UpsertId(name, storedRegion{Name: name, Order: i, Geometry: geometry})
+
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	_, err = c.RemoveAll(bson.M{"_id": bson.M{"$nin": regionNames}})
+
+	if err != nil {
+		panic(err)
+	}
+}
+
+// reverseRegion returns the name of the first region in REGIONS_FILE that
+// contains lon/lat.
+func reverseRegion(s *mgo.Session) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session := readSession(s)
+		defer session.Close()
+
+		queries := r.URL.Query()
+
+		lon, lonErr := strconv.ParseFloat(queries.Get("lon"), 64)
+		lat, latErr := strconv.ParseFloat(queries.Get("lat"), 64)
+
+		if lonErr != nil || latErr != nil || lon < -180 || lon > 180 || lat < -90 || lat > 90 {
+			errorWithJSON(w, "lon and lat must be valid coordinates", http.StatusBadRequest)
+			return
+		}
+
+		var region storedRegion
+
+		c := session.DB(os.Getenv("DB_NAME")).C(regionCollection)
+		query := bson.M{"geometry": bson.M{"$geoIntersects": bson.M{
+			"$geometry": bson.M{"type": "Point", "coordinates": []float64{lon, lat}},
+		}}}
+		err := c.Find(query).Sort("order").Select(bson.M{"_id": 1}).One(&region)
+
+		if err != nil {
+			switch err {
+			default:
+				errorWithJSON(w, "Database error", http.StatusInternalServerError)
+				log.Println("Failed find region: ", err)
+				return
+			case mgo.ErrNotFound:
+				errorWithJSON(w, "No region contains these coordinates", http.StatusNotFound)
+				return
+			}
+		}
+
+		jsonData, err := json.Marshal(map[string]string{"name": region.Name})
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		responseWithJSON(w, jsonData, http.StatusOK)
+	}
+}
@@ -0,0 +1,1236 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	shapeArray string = "array"
+	shapeMap   string = "map"
+)
+
+// maxNearest caps nearest, which unlike maxDistance can reach any record.
+const maxNearest int = 100
+
+type searchParams struct {
+	Skip            int         `json:"skip"`
+	Limit           int         `json:"limit"`
+	Page            int         `json:"page"`
+	PageSize        int         `json:"pageSize"`
+	Text            string      `json:"text"`
+	ExactPhrase     bool        `json:"exactPhrase"`
+	Lang            string      `json:"lang"`
+	Hint            string      `json:"hint"`
+	CityHint        string      `json:"cityHint"`
+	AddressHint     string      `json:"addressHint"`
+	Fuzzy           bool        `json:"fuzzy"`
+	Phone           string      `json:"phone"`
+	OrgNumber       string      `json:"orgNumber"`
+	MinCompleteness float64     `json:"minCompleteness"`
+	HasWebsite      *bool       `json:"hasWebsite"`
+	HasEmail        *bool       `json:"hasEmail"`
+	HasPhone        *bool       `json:"hasPhone"`
+	Lon             float64     `json:"lon"`
+	Lat             float64     `json:"lat"`
+	LocationScope   int         `json:"-"`
+	Nearest         int         `json:"nearest"`
+	Polygon         [][]float64 `json:"polygon"`
+	Region          string      `json:"region"`
+	Tags            []string    `json:"tags"`
+	Exclude         []string    `json:"exclude"`
+	Buckets         []float64   `json:"buckets"`
+	Facets          []string    `json:"facets"`
+	Highlight       bool        `json:"highlight"`
+	HighlightPre    string      `json:"highlightPre"`
+	HighlightPost   string      `json:"highlightPost"`
+	CountMode       string      `json:"countMode"`
+	IDsOnly         bool        `json:"idsOnly"`
+	Shape           string      `json:"shape"`
+	IncludeDeleted  bool        `json:"includeDeleted"`
+	CreatedBy       string      `json:"createdBy"`
+	UpdatedBy       string      `json:"updatedBy"`
+	Rank            string      `json:"rank"`
+	Boost           string      `json:"boost"`
+	RatingWeight    float64     `json:"ratingWeight"`
+	DistanceWeight  float64     `json:"distanceWeight"`
+	TextWeight      float64     `json:"textWeight"`
+	offsetSet       bool
+	locationSet     bool
+	regionGeometry  map[string]interface{}
+	textFallback    bool
+}
+
+func defaultSearchParams() searchParams {
+	return searchParams{
+		Skip:           0,
+		Limit:          10,
+		LocationScope:  3000,
+		HighlightPre:   defaultHighlightPre,
+		HighlightPost:  defaultHighlightPost,
+		CountMode:      countModeExact,
+		TextWeight:     defaultTextWeight,
+		RatingWeight:   1,
+		DistanceWeight: 1,
+	}
+}
+
+func parseSearchQuery(queries url.Values) (params searchParams, err error) {
+	params = defaultSearchParams()
+
+	skipQuery, ok := queries["skip"]
+
+	if ok {
+		if len(skipQuery) > 0 {
+			params.Skip, err = strconv.Atoi(skipQuery[0])
+
+			if err != nil {
+				err = fmt.Errorf("skip must be a number")
+				return
+			}
+
+			params.offsetSet = true
+		}
+	}
+
+	limitQuery, ok := queries["limit"]
+
+	if ok {
+		if len(limitQuery) > 0 {
+			params.Limit, err = strconv.Atoi(limitQuery[0])
+
+			if err != nil {
+				err = fmt.Errorf("limit must be a number")
+				return
+			}
+
+			params.offsetSet = true
+		}
+	}
+
+	pageQuery, ok := queries["page"]
+
+	if ok {
+		if len(pageQuery) > 0 {
+			params.Page, err = strconv.Atoi(pageQuery[0])
+
+			if err != nil {
+				err = fmt.Errorf("page must be a number")
+				return
+			}
+
+			// applyPage can't tell page=0 from no page at all.
+			if params.Page < 1 {
+				err = fmt.Errorf("page must be 1 or greater")
+				return
+			}
+		}
+	}
+
+	pageSizeQuery, ok := queries["pageSize"]
+
+	if ok {
+		if len(pageSizeQuery) > 0 {
+			params.PageSize, err = strconv.Atoi(pageSizeQuery[0])
+
+			if err != nil {
+				err = fmt.Errorf("pageSize must be a number")
+				return
+			}
+		}
+	}
+
+	textQuery, ok := queries["text"]
+
+	if ok {
+		if len(textQuery) > 0 {
+			params.Text = textQuery[0]
+		}
+	}
+
+	exactPhraseQuery, ok := queries["exactPhrase"]
+
+	if ok {
+		if len(exactPhraseQuery) > 0 {
+			params.ExactPhrase = exactPhraseQuery[0] == "true"
+		}
+	}
+
+	langQuery, ok := queries["lang"]
+
+	if ok {
+		if len(langQuery) > 0 {
+			params.Lang = langQuery[0]
+		}
+	}
+
+	hintQuery, ok := queries["hint"]
+
+	if ok {
+		if len(hintQuery) > 0 {
+			params.Hint = hintQuery[0]
+		}
+	}
+
+	cityHintQuery, ok := queries["cityHint"]
+
+	if ok {
+		if len(cityHintQuery) > 0 {
+			params.CityHint = cityHintQuery[0]
+		}
+	}
+
+	addressHintQuery, ok := queries["addressHint"]
+
+	if ok {
+		if len(addressHintQuery) > 0 {
+			params.AddressHint = addressHintQuery[0]
+		}
+	}
+
+	fuzzyQuery, ok := queries["fuzzy"]
+
+	if ok {
+		if len(fuzzyQuery) > 0 {
+			params.Fuzzy = fuzzyQuery[0] == "true"
+		}
+	}
+
+	phoneQuery, ok := queries["phone"]
+
+	if ok {
+		if len(phoneQuery) > 0 {
+			params.Phone = phoneQuery[0]
+		}
+	}
+
+	orgNumberQuery, ok := queries["orgNumber"]
+
+	if ok {
+		if len(orgNumberQuery) > 0 {
+			params.OrgNumber = orgNumberQuery[0]
+		}
+	}
+
+	minCompletenessQuery, ok := queries["minCompleteness"]
+
+	if ok {
+		if len(minCompletenessQuery) > 0 {
+			params.MinCompleteness, err = strconv.ParseFloat(minCompletenessQuery[0], 64)
+
+			if err != nil {
+				err = fmt.Errorf("minCompleteness must be a number")
+				return
+			}
+		}
+	}
+
+	hasWebsiteQuery, ok := queries["hasWebsite"]
+
+	if ok {
+		if len(hasWebsiteQuery) > 0 {
+			var hasWebsite bool
+			hasWebsite, err = strconv.ParseBool(hasWebsiteQuery[0])
+
+			if err != nil {
+				err = fmt.Errorf("hasWebsite must be true or false")
+				return
+			}
+
+			params.HasWebsite = &hasWebsite
+		}
+	}
+
+	hasEmailQuery, ok := queries["hasEmail"]
+
+	if ok {
+		if len(hasEmailQuery) > 0 {
+			var hasEmail bool
+			hasEmail, err = strconv.ParseBool(hasEmailQuery[0])
+
+			if err != nil {
+				err = fmt.Errorf("hasEmail must be true or false")
+				return
+			}
+
+			params.HasEmail = &hasEmail
+		}
+	}
+
+	hasPhoneQuery, ok := queries["hasPhone"]
+
+	if ok {
+		if len(hasPhoneQuery) > 0 {
+			var hasPhone bool
+			hasPhone, err = strconv.ParseBool(hasPhoneQuery[0])
+
+			if err != nil {
+				err = fmt.Errorf("hasPhone must be true or false")
+				return
+			}
+
+			params.HasPhone = &hasPhone
+		}
+	}
+
+	lonQuery, ok := queries["lon"]
+
+	if ok {
+		if len(lonQuery) > 0 {
+			params.Lon, _ = strconv.ParseFloat(lonQuery[0], 64)
+			params.locationSet = true
+		}
+	}
+
+	latQuery, ok := queries["lat"]
+
+	if ok {
+		if len(latQuery) > 0 {
+			params.Lat, _ = strconv.ParseFloat(latQuery[0], 64)
+			params.locationSet = true
+		}
+	}
+
+	regionQuery, ok := queries["region"]
+
+	if ok {
+		if len(regionQuery) > 0 {
+			params.Region = regionQuery[0]
+		}
+	}
+
+	nearestQuery, ok := queries["nearest"]
+
+	if ok {
+		if len(nearestQuery) > 0 {
+			params.Nearest, err = strconv.Atoi(nearestQuery[0])
+
+			if err != nil || params.Nearest < 1 {
+				err = fmt.Errorf("nearest must be between 1 and %v", maxNearest)
+				return
+			}
+		}
+	}
+
+	tagsQuery, ok := queries["tags"]
+
+	if ok {
+		if len(tagsQuery) > 0 {
+			params.Tags = strings.Split(tagsQuery[0], ",")
+		}
+	}
+
+	excludeQuery, ok := queries["exclude"]
+
+	if ok {
+		if len(excludeQuery) > 0 {
+			params.Exclude = strings.Split(excludeQuery[0], ",")
+		}
+	}
+
+	highlightQuery, ok := queries["highlight"]
+
+	if ok {
+		if len(highlightQuery) > 0 {
+			params.Highlight = highlightQuery[0] == "true"
+		}
+	}
+
+	highlightPreQuery, ok := queries["highlightPre"]
+
+	if ok {
+		if len(highlightPreQuery) > 0 {
+			params.HighlightPre = highlightPreQuery[0]
+		}
+	}
+
+	highlightPostQuery, ok := queries["highlightPost"]
+
+	if ok {
+		if len(highlightPostQuery) > 0 {
+			params.HighlightPost = highlightPostQuery[0]
+		}
+	}
+
+	idsOnlyQuery, ok := queries["idsOnly"]
+
+	if ok {
+		if len(idsOnlyQuery) > 0 {
+			params.IDsOnly = idsOnlyQuery[0] == "true"
+		}
+	}
+
+	includeDeletedQuery, ok := queries["includeDeleted"]
+
+	if ok {
+		if len(includeDeletedQuery) > 0 {
+			params.IncludeDeleted = includeDeletedQuery[0] == "true"
+		}
+	}
+
+	createdByQuery, ok := queries["createdBy"]
+
+	if ok {
+		if len(createdByQuery) > 0 {
+			params.CreatedBy = createdByQuery[0]
+		}
+	}
+
+	updatedByQuery, ok := queries["updatedBy"]
+
+	if ok {
+		if len(updatedByQuery) > 0 {
+			params.UpdatedBy = updatedByQuery[0]
+		}
+	}
+
+	approxCountQuery, ok := queries["approxCount"]
+
+	if ok {
+		if len(approxCountQuery) > 0 && approxCountQuery[0] == "true" {
+			params.CountMode = countModeApprox
+		}
+	}
+
+	shapeQuery, ok := queries["shape"]
+
+	if ok {
+		if len(shapeQuery) > 0 {
+			params.Shape = shapeQuery[0]
+		}
+	}
+
+	countModeQuery, ok := queries["countMode"]
+
+	if ok {
+		if len(countModeQuery) > 0 {
+			params.CountMode = countModeQuery[0]
+		}
+	}
+
+	rankQuery, ok := queries["rank"]
+
+	if ok {
+		if len(rankQuery) > 0 {
+			params.Rank = rankQuery[0]
+		}
+	}
+
+	boostQuery, ok := queries["boost"]
+
+	if ok {
+		if len(boostQuery) > 0 {
+			params.Boost = boostQuery[0]
+		}
+	}
+
+	ratingWeightQuery, ok := queries["ratingWeight"]
+
+	if ok {
+		if len(ratingWeightQuery) > 0 {
+			params.RatingWeight, err = strconv.ParseFloat(ratingWeightQuery[0], 64)
+
+			if err != nil {
+				err = fmt.Errorf("ratingWeight must be a number")
+				return
+			}
+		}
+	}
+
+	distanceWeightQuery, ok := queries["distanceWeight"]
+
+	if ok {
+		if len(distanceWeightQuery) > 0 {
+			params.DistanceWeight, err = strconv.ParseFloat(distanceWeightQuery[0], 64)
+
+			if err != nil {
+				err = fmt.Errorf("distanceWeight must be a number")
+				return
+			}
+		}
+	}
+
+	textWeightQuery, ok := queries["textWeight"]
+
+	if ok {
+		if len(textWeightQuery) > 0 {
+			params.TextWeight, err = strconv.ParseFloat(textWeightQuery[0], 64)
+
+			if err != nil {
+				err = fmt.Errorf("textWeight must be a number")
+				return
+			}
+		}
+	}
+
+	facetsQuery, ok := queries["facets"]
+
+	if ok {
+		if len(facetsQuery) > 0 {
+			params.Facets, err = parseFacets(facetsQuery[0])
+
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	bucketsQuery, ok := queries["buckets"]
+
+	if ok {
+		if len(bucketsQuery) > 0 {
+			params.Buckets, err = parseBuckets(bucketsQuery[0])
+
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	return
+}
+
+// applyPage translates page/pageSize into skip/limit.
+func (params *searchParams) applyPage() error {
+	if params.Page == 0 && params.PageSize == 0 {
+		return nil
+	}
+
+	if params.offsetSet {
+		return fmt.Errorf("use either skip/limit or page/pageSize, not both")
+	}
+
+	if params.Page == 0 {
+		params.Page = 1
+	}
+
+	if params.PageSize == 0 {
+		params.PageSize = params.Limit
+	}
+
+	if params.Page < 1 {
+		return fmt.Errorf("page must be 1 or greater")
+	}
+
+	if params.PageSize < 1 {
+		return fmt.Errorf("pageSize must be 1 or greater")
+	}
+
+	params.Skip = (params.Page - 1) * params.PageSize
+	params.Limit = params.PageSize
+	return nil
+}
+
+// adminOnly reports whether params use options reserved for admins.
+func (params searchParams) adminOnly() bool {
+	return params.IncludeDeleted || params.CreatedBy != "" || params.UpdatedBy != ""
+}
+
+func (params searchParams) validate() error {
+	if params.Skip+params.Limit > maxResultWindow {
+		return fmt.Errorf("skip + limit must not exceed %v; to read further, page through /changes with its cursor", maxResultWindow)
+	}
+
+	if _, ok := textLanguage(params.Lang); params.Lang != "" && !ok {
+		return fmt.Errorf("lang must be one of nb, nn, no, en or none")
+	}
+
+	if params.Shape != "" && params.Shape != shapeArray && params.Shape != shapeMap {
+		return fmt.Errorf("shape must be array or map")
+	}
+
+	if !validCountMode(params.CountMode) {
+		return fmt.Errorf("countMode must be exact, estimate, approximate or none")
+	}
+
+	if params.Rank != "" && params.Rank != rankCombined {
+		return fmt.Errorf("rank must be combined")
+	}
+
+	if params.ExactPhrase && (params.Text == "" || params.Fuzzy) {
+		return fmt.Errorf("exactPhrase requires text and can't be combined with fuzzy")
+	}
+
+	// $text can't be part of a $geoNear query, so text near a point needs
+	// rank=combined or fuzzy, which both match text separately.
+	if params.Text != "" && params.locationSet && params.Rank != rankCombined && !params.Fuzzy {
+		return fmt.Errorf("text can't be combined with lon and lat unless rank=combined or fuzzy=true")
+	}
+
+	if params.Rank == rankCombined && (params.Text == "" || !params.locationSet) {
+		return fmt.Errorf("rank=combined requires text, lon and lat")
+	}
+
+	if params.Boost != "" && params.Boost != boostRating {
+		return fmt.Errorf("boost must be rating")
+	}
+
+	if params.Boost == boostRating && (!params.locationSet || len(params.Buckets) > 0) {
+		return fmt.Errorf("boost=rating requires lon and lat and can't be combined with buckets")
+	}
+
+	if params.RatingWeight < 0 || params.DistanceWeight < 0 {
+		return fmt.Errorf("ratingWeight and distanceWeight must not be negative")
+	}
+
+	if params.TextWeight < 0 || params.TextWeight > 1 {
+		return fmt.Errorf("textWeight must be between 0 and 1")
+	}
+
+	if params.Nearest < 0 || params.Nearest > maxNearest {
+		return fmt.Errorf("nearest must be between 1 and %v", maxNearest)
+	}
+
+	if params.Nearest > 0 && (!params.locationSet || len(params.Buckets) > 0) {
+		return fmt.Errorf("nearest requires lon and lat and can't be combined with buckets")
+	}
+
+	for _, id := range params.Exclude {
+		if !bson.IsObjectIdHex(id) {
+			return fmt.Errorf("exclude must be comma-separated ids, %q is not an id", id)
+		}
+	}
+
+	for i, distance := range params.Buckets {
+		if distance <= 0 {
+			return fmt.Errorf("buckets must be positive distances in meters")
+		}
+
+		if i > 0 && distance <= params.Buckets[i-1] {
+			return fmt.Errorf("buckets must be in ascending order")
+		}
+	}
+
+	if len(params.Buckets) > 0 && !params.locationSet {
+		return fmt.Errorf("buckets requires lon and lat")
+	}
+
+	for _, field := range params.Facets {
+		if !facetFields[field] {
+			return fmt.Errorf("facets must be comma-separated fields from city, county, zip, tags and language")
+		}
+	}
+
+	if len(params.Facets) > 0 && (len(params.Buckets) > 0 || params.IDsOnly || params.Shape == shapeMap || params.Fuzzy || params.Rank != "") {
+		return fmt.Errorf("facets can't be combined with buckets, idsOnly, shape=map, fuzzy or rank")
+	}
+
+	// Fuzzy matches are ranked in memory and written as they are.
+	if params.Fuzzy && params.Text != "" && (params.IDsOnly || params.Highlight || len(params.Buckets) > 0) {
+		return fmt.Errorf("fuzzy can't be combined with idsOnly, highlight or buckets")
+	}
+
+	if params.Rank == rankCombined && (params.IDsOnly || params.Highlight || len(params.Buckets) > 0 || params.Nearest > 0 || params.Boost != "") {
+		return fmt.Errorf("rank=combined can't be combined with idsOnly, highlight, buckets, nearest or boost")
+	}
+
+	if len(params.Polygon) > 0 {
+		if len(params.Polygon) < 4 {
+			return fmt.Errorf("polygon must have at least four positions")
+		}
+
+		for _, position := range params.Polygon {
+			if len(position) != 2 {
+				return fmt.Errorf("polygon positions must be [lon, lat] pairs")
+			}
+		}
+
+		first, last := params.Polygon[0], params.Polygon[len(params.Polygon)-1]
+
+		if first[0] != last[0] || first[1] != last[1] {
+			return fmt.Errorf("polygon must be closed")
+		}
+	}
+
+	return nil
+}
+
+// buildSearchPipes builds the search pipeline. Every filter goes in one
+// query, which is the $geoNear query for proximity searches since $geoNear
+// must be the first stage, and a $match otherwise.
+func buildSearchPipes(params searchParams) []bson.M {
+	filters := make([]bson.M, 0)
+	sortByName := false
+
+	if params.Text != "" && params.textFallback {
+		filter := textRegexQuery(params.Text)
+
+		if params.ExactPhrase {
+			filter = phraseRegexQuery(params.Text)
+		}
+
+		filters = append(filters, filter)
+		sortByName = true
+	} else if params.Text != "" {
+		text := bson.M{"$search": params.Text}
+
+		// A quoted $search string only matches documents containing the phrase.
+		if params.ExactPhrase {
+			text["$search"] = `"` + strings.Replace(params.Text, `"`, "", -1) + `"`
+		}
+
+		if language, ok := textLanguage(params.Lang); ok {
+			text["$language"] = language
+		}
+
+		filters = append(filters, bson.M{"$text": text})
+		sortByName = true
+	}
+
+	if params.Hint != "" {
+		filters = append(filters, bson.M{"name": bson.M{"$regex": bson.RegEx{Pattern: "^" + params.Hint, Options: "i"}}})
+		sortByName = true
+	}
+
+	if params.CityHint != "" {
+		filters = append(filters, prefixQuery("city", params.CityHint))
+	}
+
+	if params.AddressHint != "" {
+		filters = append(filters, bson.M{"$or": []bson.M{
+			prefixQuery("addressLine1", params.AddressHint),
+			prefixQuery("addressLine2", params.AddressHint),
+		}})
+	}
+
+	if phone := strings.TrimPrefix(normalizePhone(params.Phone), "+"); phone != "" {
+		filters = append(filters, bson.M{"$or": []bson.M{
+			{"phone": bson.RegEx{Pattern: "^" + phone}},
+			{"phone": bson.RegEx{Pattern: "^\\+" + phone}},
+			{"phones.number": bson.RegEx{Pattern: "^" + phone}},
+			{"phones.number": bson.RegEx{Pattern: "^\\+" + phone}},
+		}})
+	}
+
+	if params.OrgNumber != "" {
+		filters = append(filters, bson.M{"orgNumber": normalizeOrgNumber(params.OrgNumber)})
+	}
+
+	if params.CreatedBy != "" {
+		filters = append(filters, bson.M{"createdBy": params.CreatedBy})
+	}
+
+	if params.UpdatedBy != "" {
+		filters = append(filters, bson.M{"updatedBy": params.UpdatedBy})
+	}
+
+	if params.HasWebsite != nil {
+		filters = append(filters, presenceQuery("website", *params.HasWebsite))
+	}
+
+	if params.HasEmail != nil {
+		filters = append(filters, presenceQuery("email", *params.HasEmail))
+	}
+
+	// syncPhones keeps phone set to the first of phones, so checking phone
+	// covers both.
+	if params.HasPhone != nil {
+		filters = append(filters, presenceQuery("phone", *params.HasPhone))
+	}
+
+	if len(params.Polygon) > 0 {
+		filters = append(filters, bson.M{"location": bson.M{"$geoWithin": bson.M{
+			"$geometry": bson.M{"type": "Polygon", "coordinates": [][][]float64{params.Polygon}},
+		}}})
+	}
+
+	if params.regionGeometry != nil {
+		filters = append(filters, bson.M{"location": bson.M{"$geoWithin": bson.M{"$geometry": params.regionGeometry}}})
+	}
+
+	if len(params.Tags) > 0 {
+		filters = append(filters, bson.M{"tags": bson.M{"$all": params.Tags}})
+	}
+
+	match := notDeleted()
+
+	if params.IncludeDeleted {
+		match = bson.M{}
+	}
+
+	if len(params.Exclude) > 0 {
+		ids := make([]bson.ObjectId, 0, len(params.Exclude))
+
+		for _, id := range params.Exclude {
+			ids = append(ids, bson.ObjectIdHex(id))
+		}
+
+		match["_id"] = bson.M{"$nin": ids}
+	}
+
+	query := match
+
+	if len(filters) > 0 {
+		query = bson.M{"$and": append(filters, match)}
+	}
+
+	pipes := make([]bson.M, 0)
+
+	if params.locationSet {
+		maxDistance := float64(params.LocationScope)
+
+		if len(params.Buckets) > 0 {
+			maxDistance = params.Buckets[len(params.Buckets)-1]
+		}
+
+		// A GeoJSON point makes distances meters rather than radians.
+		geoNear := bson.M{
+			"near":          bson.M{"type": "Point", "coordinates": []float64{params.Lon, params.Lat}},
+			"distanceField": "distance",
+			"spherical":     true,
+			"query":         query,
+		}
+
+		if params.Nearest == 0 {
+			geoNear["maxDistance"] = maxDistance
+		}
+
+		pipes = append(pipes, bson.M{"$geoNear": geoNear})
+
+		// $geoNear lost num in MongoDB 4.2, and output is sorted by distance.
+		if params.Nearest > 0 {
+			pipes = append(pipes, bson.M{"$limit": params.Nearest})
+		}
+
+		if params.Boost == boostRating {
+			pipes = append(pipes, ratingBoostStage(params, maxDistance)...)
+		} else {
+			pipes = append(pipes, sortStage("distance"))
+		}
+	} else {
+		pipes = append(pipes, bson.M{"$match": query})
+
+		if sortByName {
+			pipes = append(pipes, sortStage("name"))
+		}
+	}
+
+	pipes = append(pipes, completenessStage())
+
+	if params.MinCompleteness > 0 {
+		pipe := bson.M{"$match": bson.M{"completeness": bson.M{"$gte": params.MinCompleteness}}}
+		pipes = append(pipes, pipe)
+	}
+
+	return pipes
+}
+
+func runSearch(w http.ResponseWriter, r *http.Request, session *mgo.Session, params searchParams) {
+	var electricians []electrician
+
+	c := session.DB(os.Getenv("DB_NAME")).C(collection)
+
+	if params.Region != "" {
+		geometry, ok := lookupRegion(params.Region)
+
+		if !ok {
+			errorWithJSON(w, "Region not found", http.StatusNotFound)
+			return
+		}
+
+		params.regionGeometry = geometry
+	}
+
+	if params.Fuzzy && params.Text != "" {
+		started := time.Now()
+		result, total, err := fuzzySearch(c, params)
+		logSlowQuery("fuzzy search", params, started)
+
+		if err != nil {
+			errorWithJSON(w, "Database error", http.StatusInternalServerError)
+			log.Println("Failed fuzzy search electricians: ", err)
+			return
+		}
+
+		if clientGone(r) {
+			return
+		}
+
+		w.Header().Set("X-Total-Count", strconv.Itoa(total))
+		writeElectricians(w, r, params, result)
+		return
+	}
+
+	if params.Rank == rankCombined {
+		started := time.Now()
+		result, total, err := combinedSearch(c, params)
+		logSlowQuery("combined search", params, started)
+
+		if err != nil {
+			// Without a text index there is no relevance to combine, so
+			// searchFailed falls back to regex matches sorted by distance.
+			params.Rank = ""
+			searchFailed(w, r, session, params, "Failed combined search electricians: ", err)
+			return
+		}
+
+		if clientGone(r) {
+			return
+		}
+
+		w.Header().Set("X-Total-Count", strconv.Itoa(total))
+		writeElectricians(w, r, params, result)
+		return
+	}
+
+	pipes := buildSearchPipes(params)
+
+	if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil {
+		started := time.Now()
+		lastModified, err := latestUpdate(c, pipes)
+		logSlowQuery("search latest update", pipes, started)
+
+		if err != nil {
+			searchFailed(w, r, session, params, "Failed get latest update: ", err)
+			return
+		}
+
+		// Legacy records without updatedAt leave it unknown, so the results
+		// can't be claimed unchanged.
+		if !lastModified.IsZero() {
+			w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+
+			if !lastModified.Truncate(time.Second).After(since) {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+	}
+
+	if clientGone(r) {
+		return
+	}
+
+	if params.CountMode != countModeNone {
+		started := time.Now()
+		total, approximate, err := countTotal(c, pipes, params.CountMode)
+		logSlowQuery("search count", pipes, started)
+
+		if err != nil {
+			searchFailed(w, r, session, params, "Failed count electricians: ", err)
+			return
+		}
+
+		w.Header().Set("X-Total-Count", strconv.Itoa(total))
+
+		if approximate {
+			w.Header().Set("X-Total-Count-Estimated", "true")
+		}
+
+		if params.PageSize > 0 {
+			totalPages := (total + params.PageSize - 1) / params.PageSize
+			w.Header().Set("X-Total-Pages", strconv.Itoa(totalPages))
+		}
+	}
+
+	if params.PageSize > 0 {
+		w.Header().Set("X-Page", strconv.Itoa(params.Page))
+		w.Header().Set("X-Page-Size", strconv.Itoa(params.PageSize))
+	}
+
+	if params.Nearest > 0 {
+		params.Skip, params.Limit = 0, params.Nearest
+	}
+
+	skip := bson.M{"$skip": params.Skip}
+	limit := bson.M{"$limit": params.Limit}
+	pipes = append(pipes, skip, limit)
+
+	if len(params.Buckets) > 0 {
+		started := time.Now()
+		result, err := bucketByDistance(c, pipes[:len(pipes)-2], params.Skip, params.Limit, params.Buckets)
+		logSlowQuery("search buckets", pipes, started)
+
+		if err != nil {
+			searchFailed(w, r, session, params, "Failed bucket electricians: ", err)
+			return
+		}
+
+		for _, bucket := range result {
+			prepareElectricians(r, bucket.Electricians)
+		}
+
+		projected, err := projectBuckets(result, responseFields(r))
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		jsonData, err := json.Marshal(projected)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		responseWithJSON(w, jsonData, http.StatusOK)
+		return
+	}
+
+	if len(params.Facets) > 0 {
+		started := time.Now()
+		result, err := facetSearch(c, pipes[:len(pipes)-2], params.Skip, params.Limit, params.Facets)
+		logSlowQuery("search facets", pipes, started)
+
+		if err != nil {
+			searchFailed(w, r, session, params, "Failed facet electricians: ", err)
+			return
+		}
+
+		if params.Highlight && params.Text != "" {
+			highlightElectricians(result.Results, params.Text, params.HighlightPre, params.HighlightPost)
+		}
+
+		prepareElectricians(r, result.Results)
+		resultsJSON, err := marshalFields(result.Results, responseFields(r))
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		jsonData, err := json.Marshal(struct {
+			Results json.RawMessage         `json:"results"`
+			Facets  map[string][]facetCount `json:"facets"`
+		}{resultsJSON, result.Facets})
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		responseWithJSON(w, jsonData, http.StatusOK)
+		return
+	}
+
+	if params.IDsOnly {
+		pipes = append(pipes, bson.M{"$project": bson.M{"_id": 1}})
+	}
+
+	if clientGone(r) {
+		return
+	}
+
+	pipe := c.Pipe(pipes)
+
+	if handlerTimeout > 0 {
+		pipe.SetMaxTime(handlerTimeout)
+	}
+
+	started := time.Now()
+	err := pipe.All(&electricians)
+	logSlowQuery("search", pipes, started)
+
+	if err != nil {
+		searchFailed(w, r, session, params, "Failed search electricians: ", err)
+		return
+	}
+
+	if clientGone(r) {
+		return
+	}
+
+	if params.IDsOnly {
+		ids := make([]string, 0, len(electricians))
+
+		for _, e := range electricians {
+			ids = append(ids, e.ID.Hex())
+		}
+
+		jsonData, err := json.Marshal(ids)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		responseWithJSON(w, jsonData, http.StatusOK)
+		return
+	}
+
+	if params.Highlight && params.Text != "" {
+		highlightElectricians(electricians, params.Text, params.HighlightPre, params.HighlightPost)
+	}
+
+	writeElectricians(w, r, params, electricians)
+}
+
+// writeElectricians responds with search results, as an array or, for
+// shape=map, as an object keyed by id, wrapped in an envelope on request.
+func writeElectricians(w http.ResponseWriter, r *http.Request, params searchParams, electricians []electrician) {
+	prepareElectricians(r, electricians)
+	jsonData, err := marshalFields(electricians, responseFields(r))
+
+	if err == nil && params.Shape == shapeMap {
+		var docs []json.RawMessage
+		err = json.Unmarshal(jsonData, &docs)
+		keyed := make(map[string]json.RawMessage, len(docs))
+
+		for i := range docs {
+			keyed[electricians[i].ID.Hex()] = docs[i]
+		}
+
+		if err == nil {
+			jsonData, err = json.Marshal(keyed)
+		}
+	}
+
+	w.Header().Add("Vary", "Accept")
+
+	if err == nil && wantsEnvelope(r) {
+		jsonData, err = envelopeResults(w, params, jsonData)
+	} else {
+		deprecateBareResults(w)
+	}
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	responseWithJSON(w, jsonData, http.StatusOK)
+}
+
+// sortStage sorts by field with _id as a tie-breaker, so paging is stable
+// among records with equal values. bson.D keeps the keys in order.
+func sortStage(field string) bson.M {
+	return bson.M{"$sort": bson.D{{Name: field, Value: 1}, {Name: "_id", Value: 1}}}
+}
+
+// presenceQuery matches records where field is non-empty, or empty/missing when present is false.
+func presenceQuery(field string, present bool) bson.M {
+	if present {
+		return bson.M{field: bson.M{"$exists": true, "$nin": []interface{}{"", nil}}}
+	}
+
+	return bson.M{field: bson.M{"$in": []interface{}{"", nil}}}
+}
+
+// searchFailed responds to a failed search query. While the text index is
+// missing or still building, $text queries fail, so the search is retried
+// with a regex over the text fields instead.
+func searchFailed(w http.ResponseWriter, r *http.Request, session *mgo.Session, params searchParams, message string, err error) {
+	if params.Text != "" && !params.textFallback && isTextIndexMissing(err) {
+		log.Println("Warning: text index unavailable, falling back to regex search: ", err)
+		params.textFallback = true
+		runSearch(w, r, session, params)
+		return
+	}
+
+	errorWithJSON(w, "Database error", http.StatusInternalServerError)
+	log.Println(message, err)
+}
+
+func isTextIndexMissing(err error) bool {
+	return strings.Contains(err.Error(), "text index required")
+}
+
+func latestUpdate(c *mgo.Collection, pipes []bson.M) (time.Time, error) {
+	var result struct {
+		UpdatedAt time.Time `bson:"updatedAt"`
+	}
+
+	group := bson.M{"$group": bson.M{"_id": nil, "updatedAt": bson.M{"$max": "$updatedAt"}}}
+	err := c.Pipe(append(pipes[:len(pipes):len(pipes)], group)).One(&result)
+
+	if err == mgo.ErrNotFound {
+		err = nil
+	}
+
+	return result.UpdatedAt, err
+}
+
+func search(s *mgo.Session) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session := readSession(s)
+		defer session.Close()
+
+		params, err := parseSearchQuery(r.URL.Query())
+
+		if params.Lang == "" {
+			params.Lang = acceptedLanguage(r.Header.Get("Accept-Language"))
+		}
+
+		if err == nil {
+			err = params.applyPage()
+		}
+
+		if err == nil {
+			err = params.validate()
+		}
+
+		if err != nil {
+			errorWithJSON(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if params.adminOnly() && permissionLevel(r) < adminPermissionLevel {
+			errorWithJSON(w, "Insufficient permissions", http.StatusForbidden)
+			return
+		}
+
+		runSearch(w, r, session, params)
+	}
+}
+
+func searchWithBody(s *mgo.Session) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session := readSession(s)
+		defer session.Close()
+
+		params := defaultSearchParams()
+
+		var fields map[string]json.RawMessage
+
+		body, err := ioutil.ReadAll(r.Body)
+
+		if err == nil {
+			err = json.Unmarshal(body, &params)
+		}
+
+		if err == nil {
+			err = json.Unmarshal(body, &fields)
+		}
+
+		if err != nil {
+			errorWithJSON(w, "Incorrect body", http.StatusBadRequest)
+			return
+		}
+
+		_, hasSkip := fields["skip"]
+		_, hasLimit := fields["limit"]
+		params.offsetSet = hasSkip || hasLimit
+
+		_, hasLon := fields["lon"]
+		_, hasLat := fields["lat"]
+		params.locationSet = hasLon || hasLat
+
+		if params.Lang == "" {
+			params.Lang = acceptedLanguage(r.Header.Get("Accept-Language"))
+		}
+
+		err = params.applyPage()
+
+		if err == nil {
+			err = params.validate()
+		}
+
+		if err != nil {
+			errorWithJSON(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if params.adminOnly() && permissionLevel(r) < adminPermissionLevel {
+			errorWithJSON(w, "Insufficient permissions", http.StatusForbidden)
+			return
+		}
+
+		runSearch(w, r, session, params)
+	}
+}
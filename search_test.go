@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net/url"
+	"reflect"
+	"sort"
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// sortDocs orders docs the way MongoDB applies a $sort specification with
+// ascending string and ObjectId keys.
+func sortDocs(docs []bson.M, keys bson.D) {
+	sort.SliceStable(docs, func(i, j int) bool {
+		for _, key := range keys {
+			a, b := docs[i][key.Name], docs[j][key.Name]
+
+			if a != b {
+				switch a := a.(type) {
+				case string:
+					return a < b.(string)
+				case bson.ObjectId:
+					return a < b.(bson.ObjectId)
+				}
+			}
+		}
+
+		return false
+	})
+}
+
+func TestSortStageOrdersSameNameByID(t *testing.T) {
+	first := bson.M{"_id": bson.ObjectIdHex("5a0000000000000000000001"), "name": "Elektro AS"}
+	second := bson.M{"_id": bson.ObjectIdHex("5a0000000000000000000002"), "name": "Elektro AS"}
+	keys := sortStage("name")["$sort"].(bson.D)
+
+	for _, docs := range [][]bson.M{{first, second}, {second, first}} {
+		sortDocs(docs, keys)
+
+		if !reflect.DeepEqual(docs, []bson.M{first, second}) {
+			t.Errorf("expected records with the same name in _id order, got %v", docs)
+		}
+	}
+}
+
+func TestBuildSearchPipesSortsByNameAndID(t *testing.T) {
+	pipes := buildSearchPipes(searchParams{Hint: "Elek", LocationScope: 3000})
+
+	for _, pipe := range pipes {
+		if pipe["$sort"] != nil {
+			if !reflect.DeepEqual(pipe, sortStage("name")) {
+				t.Errorf("expected a name and _id sort, got %v", pipe)
+			}
+
+			return
+		}
+	}
+
+	t.Errorf("expected a $sort stage in %v", pipes)
+}
+
+func TestBuildSearchPipesUsesGeoNearForNegativeLongitude(t *testing.T) {
+	params, err := parseSearchQuery(url.Values{"lon": {"-73.98"}, "lat": {"40.75"}, "nearest": {"5"}})
+
+	if err == nil {
+		err = params.validate()
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pipes := buildSearchPipes(params)
+
+	if pipes[0]["$geoNear"] == nil {
+		t.Errorf("expected the pipeline to start with $geoNear, got %v", pipes)
+	}
+}
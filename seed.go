@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// seedCollection inserts the electricians in the JSON array at SEED_FILE when
+// the collection is empty, for demos and fresh dev environments. Records are
+// normalized and validated like created ones.
+func seedCollection(s *mgo.Session) {
+	path := os.Getenv("SEED_FILE")
+
+	if path == "" {
+		return
+	}
+
+	session := s.Copy()
+	defer session.Close()
+
+	c := session.DB(os.Getenv("DB_NAME")).C(collection)
+	count, err := c.Count()
+
+	if err != nil {
+		panic(err)
+	}
+
+	if count > 0 {
+		log.Println("Skipping seed, collection is not empty")
+		return
+	}
+
+	data, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		panic(err)
+	}
+
+	var electricians []electrician
+
+	err = json.Unmarshal(data, &electricians)
+
+	if err != nil {
+		panic(err)
+	}
+
+	docs := make([]interface{}, 0, len(electricians))
+	now := time.Now()
+
+	for i := range electricians {
+		e := &electricians[i]
+
+		if e.ID == "" {
+			e.ID = bson.NewObjectId()
+		}
+
+		syncPhones(e)
+		syncPrefixFields(e)
+		e.OrgNumber = normalizeOrgNumber(e.OrgNumber)
+		e.Location.Type = "Point"
+		e.GeocodeSource = ""
+
+		if len(e.Location.Coordinates) > 0 {
+			e.GeocodeSource = geocodeSourceUser
+		}
+
+		if language, ok := textLanguage(e.Language); ok {
+			e.Language = language
+		}
+
+		if fields := validateElectrician(*e); len(fields) > 0 {
+			panic(fmt.Errorf("seed record %v in %v is invalid: %v", i, path, fields))
+		}
+
+		e.Completeness = nil
+		e.DeletedAt = nil
+		e.CreatedAt = now
+		e.UpdatedAt = now
+		e.Version = 1
+		docs = append(docs, *e)
+	}
+
+	if len(docs) == 0 {
+		return
+	}
+
+	err = c.Insert(docs...)
+
+	if err != nil {
+		panic(err)
+	}
+
+	log.Printf("Seeded %v electricians from %v", len(docs), path)
+}
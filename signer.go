@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stianba/auth-service/token"
+)
+
+// signerSecrets returns JWT_SIGNER_SECRETS, current secret first, falling
+// back to JWT_SIGNER_SECRET when it is unset.
+func signerSecrets() []string {
+	var secrets []string
+
+	for _, secret := range strings.Split(os.Getenv("JWT_SIGNER_SECRETS"), ",") {
+		secret = strings.TrimSpace(secret)
+
+		if secret != "" {
+			secrets = append(secrets, secret)
+		}
+	}
+
+	if len(secrets) == 0 {
+		secrets = append(secrets, os.Getenv("JWT_SIGNER_SECRET"))
+	}
+
+	return secrets
+}
+
+// userFromHeader works like token.FromHeader, but accepts a token signed with
+// any of the signer secrets so they can be rotated without logging users out.
+func userFromHeader(h []string) (u token.UserPersistentData, err error) {
+	var bearer string
+
+	if len(h) > 0 {
+		bearer = strings.TrimPrefix(h[0], "Bearer ")
+	}
+
+	if bearer == "" {
+		return u, fmt.Errorf("No token found")
+	}
+
+	for _, secret := range signerSecrets() {
+		var parsed *jwt.Token
+
+		parsed, err = jwt.Parse(bearer, func(t *jwt.Token) (interface{}, error) {
+			if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+				return nil, fmt.Errorf("Unexpected signing method: %v", t.Header["alg"])
+			}
+
+			return []byte(secret), nil
+		})
+
+		if err == nil && parsed != nil && parsed.Valid {
+			return userFromClaims(parsed.Claims.(jwt.MapClaims))
+		}
+	}
+
+	if err == nil {
+		err = fmt.Errorf("Invalid token")
+	}
+
+	return u, err
+}
+
+func userFromClaims(claims jwt.MapClaims) (u token.UserPersistentData, err error) {
+	id, ok := claims["id"].(string)
+
+	if !ok {
+		return u, fmt.Errorf("No id claim in token")
+	}
+
+	level, ok := claims["permissionLevel"].(float64)
+
+	if !ok {
+		return u, fmt.Errorf("No permissionLevel claim in token")
+	}
+
+	u.ID = id
+	u.PermissionLevel = level
+	return u, nil
+}
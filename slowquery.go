@@ -0,0 +1,39 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// slowQueryThreshold is zero when SLOW_QUERY_MS is unset, which disables the log.
+var slowQueryThreshold time.Duration
+
+func initSlowQueryLog() {
+	value := os.Getenv("SLOW_QUERY_MS")
+
+	if value == "" {
+		return
+	}
+
+	ms, err := strconv.Atoi(value)
+
+	if err != nil {
+		panic(err)
+	}
+
+	slowQueryThreshold = time.Duration(ms) * time.Millisecond
+}
+
+func logSlowQuery(operation string, query interface{}, started time.Time) {
+	elapsed := time.Since(started)
+
+	if slowQueryThreshold == 0 || elapsed < slowQueryThreshold {
+		return
+	}
+
+	queryJSON, _ := json.Marshal(query)
+	log.Printf("Warning: slow query %v took %v: %s", operation, elapsed, queryJSON)
+}
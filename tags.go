@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stianba/auth-service/token"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// allowedTags holds ALLOWED_TAGS. When it is empty any tag is accepted.
+var allowedTags = map[string]bool{}
+
+func initAllowedTags() {
+	for _, tag := range strings.Split(os.Getenv("ALLOWED_TAGS"), ",") {
+		tag = strings.TrimSpace(tag)
+
+		if tag != "" {
+			allowedTags[tag] = true
+		}
+	}
+}
+
+func tagAllowed(tag string) bool {
+	return tag != "" && (len(allowedTags) == 0 || allowedTags[tag])
+}
+
+type tagRequest struct {
+	IDs    []string `json:"ids"`
+	Add    []string `json:"add"`
+	Remove []string `json:"remove"`
+}
+
+type tagResult struct {
+	Modified int `json:"modified"`
+	Skipped  int `json:"skipped"`
+}
+
+// tagRoomSelector matches records with room for adding more tags without
+// exceeding maxTags: tags.N only exists on records with more than N tags.
+func tagRoomSelector(adding int) bson.M {
+	return bson.M{"tags." + strconv.Itoa(maxTags-adding): bson.M{"$exists": false}}
+}
+
+// tagElectricians adds and removes tags on many records in one bulk write.
+// Only records that actually change are touched, so modified counts a record
+// once per operation that changed it. skipped counts the records left without
+// the added tags because they could exceed maxTags.
+func tagElectricians(s *mgo.Session) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session := requestSession(s)
+		defer session.Close()
+
+		var req tagRequest
+
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&req)
+
+		if err != nil {
+			errorWithJSON(w, "Incorrect body", http.StatusBadRequest)
+			return
+		}
+
+		if len(req.IDs) == 0 || len(req.Add)+len(req.Remove) == 0 {
+			errorWithJSON(w, "ids and at least one of add or remove are required", http.StatusBadRequest)
+			return
+		}
+
+		if len(req.IDs) > maxImportSize {
+			errorWithJSON(w, fmt.Sprintf("At most %v records can be tagged at once", maxImportSize), http.StatusBadRequest)
+			return
+		}
+
+		if len(req.Add) > maxTags {
+			errorWithJSON(w, fmt.Sprintf("At most %v tags can be added", maxTags), http.StatusBadRequest)
+			return
+		}
+
+		ids := make([]bson.ObjectId, 0, len(req.IDs))
+
+		for _, id := range req.IDs {
+			if !bson.IsObjectIdHex(id) {
+				errorWithJSON(w, fmt.Sprintf("Invalid id %q", id), http.StatusBadRequest)
+				return
+			}
+
+			ids = append(ids, bson.ObjectIdHex(id))
+		}
+
+		// Tags that are no longer allowed can still be removed.
+		for _, tag := range req.Add {
+			if !tagAllowed(tag) {
+				errorWithJSON(w, fmt.Sprintf("Tag %q is not allowed", tag), http.StatusBadRequest)
+				return
+			}
+		}
+
+		c := session.DB(os.Getenv("DB_NAME")).C(collection)
+		bulk := c.Bulk()
+		touched := bson.M{"updatedAt": time.Now(), "updatedBy": token.GetContext(r).ID}
+		var skipped int
+
+		if len(req.Add) > 0 {
+			selector := notDeleted()
+			selector["_id"] = bson.M{"$in": ids}
+			selector["tags"] = bson.M{"$not": bson.M{"$all": req.Add}}
+
+			// Count records that could end up with more than maxTags tags
+			// before the bulk write leaves them out.
+			full := bson.M{"$and": []bson.M{selector, {"$nor": []bson.M{tagRoomSelector(len(req.Add))}}}}
+			skipped, err = c.Find(full).Count()
+
+			if err != nil {
+				errorWithJSON(w, "Database error", http.StatusInternalServerError)
+				log.Println("Failed count electricians without room for tags: ", err)
+				return
+			}
+
+			for field, condition := range tagRoomSelector(len(req.Add)) {
+				selector[field] = condition
+			}
+
+			bulk.UpdateAll(selector, bson.M{
+				"$addToSet": bson.M{"tags": bson.M{"$each": req.Add}},
+				"$set":      touched,
+				"$inc":      bson.M{"version": 1},
+			})
+		}
+
+		if len(req.Remove) > 0 {
+			selector := notDeleted()
+			selector["_id"] = bson.M{"$in": ids}
+			selector["tags"] = bson.M{"$in": req.Remove}
+			bulk.UpdateAll(selector, bson.M{
+				"$pullAll": bson.M{"tags": req.Remove},
+				"$set":     touched,
+				"$inc":     bson.M{"version": 1},
+			})
+		}
+
+		result, err := bulk.Run()
+
+		if err != nil {
+			errorWithJSON(w, "Database error", http.StatusInternalServerError)
+			log.Println("Failed tag electricians: ", err)
+			return
+		}
+
+		jsonData, err := json.Marshal(tagResult{Modified: result.Modified, Skipped: skipped})
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		responseWithJSON(w, jsonData, http.StatusOK)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// matchesRoomSelector evaluates a tagRoomSelector against a record with the
+// given number of tags: tags.N exists when there are more than N tags.
+func matchesRoomSelector(t *testing.T, selector bson.M, tags int) bool {
+	if len(selector) != 1 {
+		t.Fatalf("expected one condition, got %v", selector)
+	}
+
+	for field, condition := range selector {
+		index, err := strconv.Atoi(strings.TrimPrefix(field, "tags."))
+
+		if err != nil || condition.(bson.M)["$exists"] != false {
+			t.Fatalf("unexpected selector %v", selector)
+		}
+
+		return tags <= index
+	}
+
+	return false
+}
+
+func TestTagRoomSelector(t *testing.T) {
+	defer withArrayLimits(5, 3)()
+
+	tests := []struct {
+		existing int
+		adding   int
+		matches  bool
+	}{
+		{0, 1, true},
+		{4, 1, true},
+		{5, 1, false},
+		{3, 2, true},
+		{4, 2, false},
+		{0, 5, true},
+		{1, 5, false},
+	}
+
+	for _, test := range tests {
+		selector := tagRoomSelector(test.adding)
+
+		if matchesRoomSelector(t, selector, test.existing) != test.matches {
+			t.Errorf("%v tags adding %v: expected match %v with %v", test.existing, test.adding, test.matches, selector)
+		}
+	}
+}
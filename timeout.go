@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"time"
+)
+
+const handlerTimeoutBody string = "{\"message\": \"handler_timeout\"}"
+
+// handlerTimeout is zero when HANDLER_TIMEOUT is unset, which disables the limit.
+var handlerTimeout time.Duration
+
+func initHandlerTimeout() {
+	value := os.Getenv("HANDLER_TIMEOUT")
+
+	if value == "" {
+		return
+	}
+
+	timeout, err := time.ParseDuration(value)
+
+	if err != nil {
+		panic(err)
+	}
+
+	handlerTimeout = timeout
+}
+
+// streamingPaths are exempt from the handler timeout, since
+// http.TimeoutHandler buffers the whole response and they run as long as
+// the dataset takes.
+var streamingPaths = map[string]bool{}
+
+// longRunningPaths are admin jobs that loop over many records and write as
+// they go. They answer with a single body, but timing them out would report
+// a 503 while the job carries on writing.
+var longRunningPaths = map[string]bool{}
+
+func withTimeout(next http.Handler) http.Handler {
+	if handlerTimeout == 0 {
+		return next
+	}
+
+	timeoutHandler := http.TimeoutHandler(next, handlerTimeout, handlerTimeoutBody)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if streamingPaths[r.URL.Path] || longRunningPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Only used for the timeout response; handlers set their own content type.
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		timeoutHandler.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stianba/auth-service/token"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type touchResult struct {
+	ID        bson.ObjectId `json:"_id"`
+	UpdatedAt time.Time     `json:"updatedAt"`
+	Version   int           `json:"version"`
+}
+
+func touch(s *mgo.Session) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session := requestSession(s)
+		defer session.Close()
+
+		vars := mux.Vars(r)
+		id := vars["id"]
+
+		if !bson.IsObjectIdHex(id) {
+			errorWithJSON(w, "Invalid id", http.StatusBadRequest)
+			return
+		}
+
+		c := session.DB(os.Getenv("DB_NAME")).C(collection)
+
+		change := mgo.Change{
+			Update: bson.M{
+				"$set": bson.M{"updatedAt": time.Now(), "updatedBy": token.GetContext(r).ID},
+				"$inc": bson.M{"version": 1},
+			},
+			ReturnNew: true,
+		}
+
+		var electrician electrician
+		_, err := c.Find(activeID(bson.ObjectIdHex(id))).Apply(change, &electrician)
+
+		if err != nil {
+			switch err {
+			default:
+				errorWithJSON(w, "Database error", http.StatusInternalServerError)
+				log.Println("Failed touch electrician: ", err)
+				return
+			case mgo.ErrNotFound:
+				errorWithJSON(w, "Electrician not found", http.StatusNotFound)
+				return
+			}
+		}
+
+		notifyWebhooks(webhookEvent{Type: "touched", ID: id, Electrician: &electrician})
+
+		jsonData, err := json.Marshal(touchResult{ID: electrician.ID, UpdatedAt: electrician.UpdatedAt, Version: electrician.Version})
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		responseWithJSON(w, jsonData, http.StatusOK)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"unicode/utf8"
+)
+
+// maxTags and maxPhones bound the array fields to keep documents small.
+var (
+	maxTags   = 50
+	maxPhones = 10
+)
+
+func initArrayLimits() {
+	for name, limit := range map[string]*int{"MAX_TAGS": &maxTags, "MAX_PHONES": &maxPhones} {
+		value := os.Getenv(name)
+
+		if value == "" {
+			continue
+		}
+
+		n, err := strconv.Atoi(value)
+
+		if err != nil || n < 1 {
+			panic(fmt.Errorf("%v must be a positive number", name))
+		}
+
+		*limit = n
+	}
+}
+
+type validationError struct {
+	Error struct {
+		Code   string            `json:"code"`
+		Fields map[string]string `json:"fields"`
+	} `json:"error"`
+}
+
+// validateElectrician checks a normalized record and returns every field
+// problem it finds, keyed by JSON field name.
+func validateElectrician(e electrician) map[string]string {
+	fields := make(map[string]string)
+
+	if e.Name == "" {
+		fields["name"] = "required"
+	}
+
+	if digits := utf8.RuneCountInString(e.Phone); e.Phone != "" && (digits < 5 || digits > 16) {
+		fields["phone"] = "invalid"
+	}
+
+	if len(e.Phones) > maxPhones {
+		fields["phones"] = "too_many"
+	}
+
+	for i, phone := range e.Phones {
+		if digits := utf8.RuneCountInString(phone.Number); digits < 5 || digits > 16 {
+			fields[fmt.Sprintf("phones.%d", i)] = "invalid"
+		}
+	}
+
+	if e.OrgNumber != "" && !validOrgNumber(e.OrgNumber) {
+		fields["orgNumber"] = "invalid"
+	}
+
+	for _, tag := range e.Tags {
+		if !tagAllowed(tag) {
+			fields["tags"] = "unsupported"
+		}
+	}
+
+	if len(e.Tags) > maxTags {
+		fields["tags"] = "too_many"
+	}
+
+	if e.Website != "" && !validWebsite(e.Website) {
+		fields["website"] = "invalid"
+	}
+
+	if e.Email != "" && !validEmail(e.Email) {
+		fields["email"] = "invalid"
+	}
+
+	if _, ok := textLanguage(e.Language); e.Language != "" && !ok {
+		fields["language"] = "unsupported"
+	}
+
+	if e.Rating != nil && (*e.Rating < 0 || *e.Rating > maxRating) {
+		fields["rating"] = "out_of_range"
+	}
+
+	if len(e.Location.Coordinates) > 0 {
+		if err := validateCoordinates(e.Location.Coordinates); err != nil {
+			fields["location"] = err.Error()
+		}
+	}
+
+	return fields
+}
+
+// validationErrorWithJSON responds 422, or 400 when an array is over its
+// limit since that is a bound on the request rather than a data problem.
+func validationErrorWithJSON(w http.ResponseWriter, fields map[string]string) {
+	var body validationError
+	body.Error.Code = "validation"
+	body.Error.Fields = fields
+
+	status := http.StatusUnprocessableEntity
+
+	for _, problem := range fields {
+		if problem == "too_many" {
+			status = http.StatusBadRequest
+		}
+	}
+
+	jsonData, _ := json.Marshal(body)
+	responseWithJSON(w, jsonData, status)
+}
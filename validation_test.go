@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// withArrayLimits sets maxTags and maxPhones and returns a func restoring them.
+func withArrayLimits(tags, phones int) func() {
+	savedTags, savedPhones := maxTags, maxPhones
+	maxTags, maxPhones = tags, phones
+
+	return func() {
+		maxTags, maxPhones = savedTags, savedPhones
+	}
+}
+
+func withTags(n int) electrician {
+	e := electrician{Name: "Elektro AS"}
+
+	for i := 0; i < n; i++ {
+		e.Tags = append(e.Tags, fmt.Sprintf("tag%d", i))
+	}
+
+	return e
+}
+
+func withPhones(n int) electrician {
+	e := electrician{Name: "Elektro AS"}
+
+	for i := 0; i < n; i++ {
+		e.Phones = append(e.Phones, phoneNumber{Label: "work", Number: fmt.Sprintf("+4722%06d", i)})
+	}
+
+	return e
+}
+
+func TestValidateElectricianArrayLimits(t *testing.T) {
+	defer withArrayLimits(5, 3)()
+
+	tests := []struct {
+		name    string
+		record  electrician
+		field   string
+		invalid bool
+	}{
+		{"no tags", withTags(0), "tags", false},
+		{"one tag below maxTags", withTags(4), "tags", false},
+		{"maxTags tags", withTags(5), "tags", false},
+		{"one tag above maxTags", withTags(6), "tags", true},
+		{"no phones", withPhones(0), "phones", false},
+		{"one phone below maxPhones", withPhones(2), "phones", false},
+		{"maxPhones phones", withPhones(3), "phones", false},
+		{"one phone above maxPhones", withPhones(4), "phones", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fields := validateElectrician(test.record)
+
+			if test.invalid && fields[test.field] != "too_many" {
+				t.Errorf("expected %v to be too_many, got %v", test.field, fields)
+			}
+
+			if !test.invalid && len(fields) > 0 {
+				t.Errorf("expected no problems, got %v", fields)
+			}
+		})
+	}
+}
+
+func TestValidationErrorStatus(t *testing.T) {
+	tests := []struct {
+		fields map[string]string
+		status int
+	}{
+		{map[string]string{"name": "required"}, http.StatusUnprocessableEntity},
+		{map[string]string{"tags": "too_many"}, http.StatusBadRequest},
+		{map[string]string{"name": "required", "phones": "too_many"}, http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		validationErrorWithJSON(w, test.fields)
+
+		if w.Code != test.status {
+			t.Errorf("%v: expected status %v, got %v", test.fields, test.status, w.Code)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const vcardContentType string = "text/vcard; charset=utf-8"
+
+var vcardEscaper = strings.NewReplacer("\\", "\\\\", ",", "\\,", ";", "\\;", "\n", "\\n", "\r", "")
+
+func vcardEscape(value string) string {
+	return vcardEscaper.Replace(value)
+}
+
+// vcardParam makes value safe as a parameter value. Parameter values can't
+// be backslash-escaped, so per RFC 6350 section 5 they are quoted when they
+// contain , ; or : and can't contain quotes or line breaks at all.
+func vcardParam(value string) string {
+	value = strings.Map(func(r rune) rune {
+		if r == '"' || r < ' ' {
+			return -1
+		}
+
+		return r
+	}, value)
+
+	if strings.ContainsAny(value, ",;:") {
+		return "\"" + value + "\""
+	}
+
+	return value
+}
+
+// writeVCard renders e as a vCard 3.0 card with CRLF line endings.
+func writeVCard(w io.Writer, e electrician) error {
+	lines := []string{
+		"BEGIN:VCARD",
+		"VERSION:3.0",
+		"UID:" + e.ID.Hex(),
+		"FN:" + vcardEscape(e.Name),
+		"ORG:" + vcardEscape(e.Name),
+	}
+
+	phones := e.Phones
+
+	if len(phones) == 0 && e.Phone != "" {
+		phones = []phoneNumber{{Label: primaryPhoneLabel, Number: e.Phone}}
+	}
+
+	for _, phone := range phones {
+		types := "voice"
+
+		if label := vcardParam(phone.Label); label != "" {
+			types += "," + label
+		}
+
+		lines = append(lines, fmt.Sprintf("TEL;TYPE=%v:%v", types, vcardEscape(phone.Number)))
+	}
+
+	street := strings.TrimSpace(e.AddressLine1 + " " + e.AddressLine2)
+	lines = append(lines, fmt.Sprintf("ADR;TYPE=work:;;%v;%v;%v;%v;", vcardEscape(street), vcardEscape(e.City), vcardEscape(e.County), vcardEscape(e.Zip)))
+
+	if len(e.Location.Coordinates) == 2 {
+		lines = append(lines, fmt.Sprintf("GEO:%v;%v", e.Location.Coordinates[1], e.Location.Coordinates[0]))
+	}
+
+	if e.Email != "" {
+		lines = append(lines, "EMAIL;TYPE=work:"+vcardEscape(e.Email))
+	}
+
+	if e.Website != "" {
+		lines = append(lines, "URL:"+vcardEscape(e.Website))
+	}
+
+	if !e.UpdatedAt.IsZero() {
+		lines = append(lines, "REV:"+e.UpdatedAt.UTC().Format(time.RFC3339))
+	}
+
+	lines = append(lines, "END:VCARD")
+
+	_, err := io.WriteString(w, strings.Join(lines, "\r\n")+"\r\n")
+	return err
+}
+
+func getVCard(s *mgo.Session) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session := readSession(s)
+		defer session.Close()
+
+		vars := mux.Vars(r)
+		id := vars["id"]
+
+		if !bson.IsObjectIdHex(id) {
+			errorWithJSON(w, "Invalid id", http.StatusBadRequest)
+			return
+		}
+
+		c := session.DB(os.Getenv("DB_NAME")).C(collection)
+
+		var electrician electrician
+		err := c.Find(activeID(bson.ObjectIdHex(id))).One(&electrician)
+
+		if err != nil {
+			switch err {
+			default:
+				errorWithJSON(w, "Database error", http.StatusInternalServerError)
+				log.Println("Failed get electrician: ", err)
+				return
+			case mgo.ErrNotFound:
+				errorWithJSON(w, "Electrician not found", http.StatusNotFound)
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", vcardContentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", id+".vcf"))
+		w.WriteHeader(http.StatusOK)
+		writeVCard(w, electrician)
+	}
+}
+
+// exportVCards streams every electrician as one .vcf file. It is admin-only
+// since it is exempt from the handler timeout and the concurrency limit.
+func exportVCards(s *mgo.Session) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session := streamSession(s)
+		defer session.Close()
+
+		c := session.DB(os.Getenv("DB_NAME")).C(collection)
+		iter := c.Find(notDeleted()).Sort("name", "_id").Iter()
+
+		w.Header().Set("Content-Type", vcardContentType)
+		w.Header().Set("Content-Disposition", "attachment; filename=\"electricians.vcf\"")
+		w.WriteHeader(http.StatusOK)
+
+		var e electrician
+
+		for iter.Next(&e) {
+			err := writeVCard(w, e)
+
+			if err != nil || clientGone(r) {
+				iter.Close()
+				return
+			}
+
+			e = electrician{}
+		}
+
+		err := iter.Close()
+
+		if err != nil {
+			log.Println("Failed export electricians: ", err)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	webhookAttempts = 3
+	webhookTimeout  = 5 * time.Second
+)
+
+type webhookEvent struct {
+	Type        string       `json:"type"`
+	ID          string       `json:"id"`
+	Electrician *electrician `json:"electrician,omitempty"`
+}
+
+var webhookClient = &http.Client{Timeout: webhookTimeout}
+
+func webhookURLs() []string {
+	var urls []string
+
+	for _, u := range strings.Split(os.Getenv("WEBHOOK_URLS"), ",") {
+		u = strings.TrimSpace(u)
+
+		if u != "" {
+			urls = append(urls, u)
+		}
+	}
+
+	return urls
+}
+
+func notifyWebhooks(event webhookEvent) {
+	urls := webhookURLs()
+
+	if len(urls) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(event)
+
+	if err != nil {
+		log.Println("Failed to marshal webhook event: ", err)
+		return
+	}
+
+	for _, url := range urls {
+		go postWebhook(url, body)
+	}
+}
+
+func postWebhook(url string, body []byte) {
+	backoff := time.Second
+
+	for attempt := 1; attempt <= webhookAttempts; attempt++ {
+		res, err := webhookClient.Post(url, "application/json; charset=utf-8", bytes.NewReader(body))
+
+		if err == nil {
+			res.Body.Close()
+
+			if res.StatusCode < 300 {
+				return
+			}
+
+			log.Printf("Webhook %v responded with %v (attempt %v)", url, res.StatusCode, attempt)
+		} else {
+			log.Printf("Webhook %v failed (attempt %v): %v", url, attempt, err)
+		}
+
+		if attempt < webhookAttempts {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+
+	log.Println("Giving up on webhook: ", url)
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"os"
+	"strconv"
+)
+
+const defaultMaxResultWindow int = 10000
+
+// maxResultWindow caps skip + limit, since Mongo has to scan and discard
+// every skipped document.
+var maxResultWindow = defaultMaxResultWindow
+
+func initResultWindow() {
+	value := os.Getenv("MAX_RESULT_WINDOW")
+
+	if value == "" {
+		return
+	}
+
+	window, err := strconv.Atoi(value)
+
+	if err != nil {
+		panic(err)
+	}
+
+	maxResultWindow = window
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"gopkg.in/mgo.v2"
+)
+
+const (
+	writeConcernHeader         string = "X-Write-Concern"
+	maxWriteConcernNodes       int    = 50
+	defaultWriteConcernTimeout        = 10 * time.Second
+)
+
+// writeConcernTimeout is how long a write waits for the requested nodes
+// before failing. It stays under HANDLER_TIMEOUT, so a write concern the
+// replica set can't meet fails with a database error instead of a timeout.
+func writeConcernTimeout() time.Duration {
+	if handlerTimeout > 0 {
+		return handlerTimeout * 3 / 4
+	}
+
+	return defaultWriteConcernTimeout
+}
+
+// parseWriteConcern reads a write concern such as 0, 1, 2 or majority. A nil
+// result means unacknowledged writes.
+func parseWriteConcern(value string) (*mgo.Safe, error) {
+	wtimeout := int(writeConcernTimeout() / time.Millisecond)
+
+	if value == "majority" {
+		return &mgo.Safe{WMode: "majority", WTimeout: wtimeout}, nil
+	}
+
+	w, err := strconv.Atoi(value)
+
+	// A replica set has at most 50 members.
+	if err != nil || w < 0 || w > maxWriteConcernNodes {
+		return nil, fmt.Errorf("write concern must be a number of nodes up to %v or majority", maxWriteConcernNodes)
+	}
+
+	if w == 0 {
+		return nil, nil
+	}
+
+	return &mgo.Safe{W: w, WTimeout: wtimeout}, nil
+}
+
+// initWriteConcern sets the default write concern from WRITE_CONCERN.
+func initWriteConcern(session *mgo.Session) {
+	value := os.Getenv("WRITE_CONCERN")
+
+	if value == "" {
+		return
+	}
+
+	safe, err := parseWriteConcern(value)
+
+	if err != nil {
+		panic(err)
+	}
+
+	session.SetSafe(safe)
+}
+
+// requestWriteConcern applies the X-Write-Concern header, if sent, to a
+// session copied for the request.
+func requestWriteConcern(session *mgo.Session, r *http.Request) error {
+	value := r.Header.Get(writeConcernHeader)
+
+	if value == "" {
+		return nil
+	}
+
+	safe, err := parseWriteConcern(value)
+
+	if err != nil {
+		return err
+	}
+
+	session.SetSafe(safe)
+	return nil
+}
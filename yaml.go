@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+
+	"gopkg.in/yaml.v2"
+)
+
+// decodeBody decodes a JSON body, or a YAML body when the Content-Type is
+// application/x-yaml. YAML is converted to JSON first so both formats go
+// through the same field names and JSON unmarshallers.
+func decodeBody(r *http.Request, v interface{}) error {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	if mediaType != "application/x-yaml" && mediaType != "application/yaml" && mediaType != "text/yaml" {
+		return json.NewDecoder(r.Body).Decode(v)
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+
+	if err != nil {
+		return err
+	}
+
+	var document interface{}
+	err = yaml.Unmarshal(body, &document)
+
+	if err != nil {
+		return err
+	}
+
+	jsonData, err := json.Marshal(yamlToJSON(document))
+
+	if err != nil {
+		return err
+	}
+
+	return json.NewDecoder(bytes.NewReader(jsonData)).Decode(v)
+}
+
+// yamlToJSON replaces the map[interface{}]interface{} maps produced by the
+// YAML decoder with string-keyed maps that encoding/json can marshal.
+func yamlToJSON(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[interface{}]interface{}:
+		object := make(map[string]interface{}, len(value))
+
+		for key, item := range value {
+			object[fmt.Sprint(key)] = yamlToJSON(item)
+		}
+
+		return object
+	case []interface{}:
+		for i, item := range value {
+			value[i] = yamlToJSON(item)
+		}
+	}
+
+	return value
+}